@@ -0,0 +1,99 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/leekchan/accounting"
+	"github.com/spf13/cobra"
+	"gitlab.com/almost_cc/govoice/cmd/helpers"
+	"gitlab.com/almost_cc/govoice/config"
+	gv "gitlab.com/almost_cc/govoice/invoice"
+)
+
+// agingCmd represents the report aging command
+var agingCmd = &cobra.Command{
+	Use:   "aging",
+	Short: "accounts receivable aging report",
+	Long: `the outstanding balance of the open and partially paid invoices by customer,
+grouped by days past the due date: current, 1-30, 31-60, 61-90 and 90+ days.
+
+The report uses the invoices in the search index issued up to the date, run
+govoice index if the index is not up to date, and the payments and the credit
+notes of the payment ledger recorded up to the date.
+
+Examples:
+govoice report aging                       // aging report at today
+govoice report aging --date 2026-09-30     // aging report at the end of september
+govoice report aging --format json         // aging report as JSON
+`,
+	Run: aging,
+}
+
+func init() {
+	reportCmd.AddCommand(agingCmd)
+
+	agingCmd.Flags().String("date", time.Now().Format(config.QueryDateFormat), "date of the report")
+}
+
+func aging(cmd *cobra.Command, args []string) {
+
+	ds, _ := cmd.Flags().GetString("date")
+	date, err := time.Parse(config.QueryDateFormat, ds)
+	if err != nil {
+		fmt.Println("unrecognized date", ds)
+		return
+	}
+
+	password, err := gv.ReadPassword("Enter password:")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	report, err := gv.GetAgingReport(date, password)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	table := &helpers.TableData{}
+	table.SetHeader(append(append([]string{"Customer", "Invoices"}, report.Buckets...), "Total")...)
+	format, _ := cmd.Flags().GetString("format")
+	// for amount formatting, plain numbers in csv
+	ac := accounting.Accounting{Symbol: helpers.CurrencySymbol(report.Currency), Precision: gv.CurrencyDecimals(report.Currency)}
+	amount := ac.FormatMoney
+	if format == config.ReportFormatCSV {
+		amount = func(v interface{}) string { return strconv.FormatFloat(v.(float64), 'f', ac.Precision, 64) }
+	}
+	row := func(r gv.AgingRow) []string {
+		cells := []string{r.Customer, strconv.Itoa(r.Invoices)}
+		for _, b := range r.Buckets {
+			cells = append(cells, amount(b))
+		}
+		return append(cells, amount(r.Total))
+	}
+	for _, r := range report.Rows {
+		table.AddRow(row(r)...)
+	}
+	totals := row(report.Totals)
+	totals[0] = "Total"
+	table.SetFooter(totals...)
+
+	renderReport(cmd, table, report)
+}
@@ -0,0 +1,73 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/almost_cc/govoice/cmd/helpers"
+	gv "gitlab.com/almost_cc/govoice/invoice"
+)
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "check the invoice numbers in the workspace for gaps and duplicates",
+	Long: `scan the invoices in the workspace and report, for every series,
+the numbers missing from the sequence and the numbers used more than once.
+
+Only the invoice numbers matching the numberPattern of the configuration are checked.
+`,
+	Run: check,
+}
+
+func init() {
+	RootCmd.AddCommand(checkCmd)
+}
+
+func check(cmd *cobra.Command, args []string) {
+	report, err := gv.CheckNumbering()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if report.Ok() {
+		fmt.Println("checked", report.Checked, "invoice numbers, no gaps or duplicates found")
+		return
+	}
+
+	table := &helpers.TableData{}
+	table.SetHeader("Problem", "Series", "Year", "Numbers")
+	for _, g := range report.Gaps {
+		year := ""
+		if g.Year > 0 {
+			year = fmt.Sprint(g.Year)
+		}
+		seq := fmt.Sprint(g.From)
+		if g.To > g.From {
+			seq = fmt.Sprint(g.From, " - ", g.To)
+		}
+		table.AddRow("gap", g.Series, year, seq)
+	}
+	for _, d := range report.Duplicates {
+		table.AddRow("duplicate", "", "", strings.Join(d, ", "))
+	}
+	println()
+	helpers.RenderTable(table)
+	println()
+	fmt.Println("checked", report.Checked, "invoice numbers:", len(report.Gaps), "gaps,", len(report.Duplicates), "duplicates")
+}
@@ -0,0 +1,80 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/skratchdot/open-golang/open"
+	"github.com/spf13/cobra"
+	"gitlab.com/almost_cc/govoice/config"
+	gv "gitlab.com/almost_cc/govoice/invoice"
+)
+
+// creditCmd represents the credit command
+var creditCmd = &cobra.Command{
+	Use:   "credit INVOICE_NUMBER",
+	Short: "create the credit note of an invoice",
+	Long: `create a credit note that cancels an invoice: the credit note has the same
+items of the invoice with negative quantities, a number of the credit series and
+a reference to the number of the invoice.
+
+The invoice is not modified, it is marked as credited in the search index.
+To correct an invoice, credit it and render a new one.
+
+Examples:
+govoice credit 2026-0012                  // credit note with the next number of the credit series
+govoice credit 2026-0012 --number CN-12   // credit note with a given number
+`,
+	Run: credit,
+}
+
+func init() {
+	RootCmd.AddCommand(creditCmd)
+
+	creditCmd.Flags().String("number", "", "number of the credit note, defaults to the next number of the credit series")
+	creditCmd.Flags().StringVarP(&config.TemplateName, fname, "t", config.DefaultTemplateName, "template name or path")
+}
+
+func credit(cmd *cobra.Command, args []string) {
+
+	if len(args) != 1 {
+		fmt.Println(cmd.Name(), "requires parameter INVOICE_NUMBER")
+		cmd.Help()
+		return
+	}
+
+	password, err := gv.ReadPassword("Enter password:")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	templatePath, te := config.GetTemplatePath(config.TemplateName)
+	if !te {
+		fmt.Println("template file", templatePath, "does not exists")
+		return
+	}
+
+	number, _ := cmd.Flags().GetString("number")
+	creditNote, err := gv.CreditInvoice(args[0], number, password, templatePath)
+	if err != nil {
+		fmt.Println("credit note not created:", err)
+		return
+	}
+	path, _ := config.GetInvoicePdfPath(creditNote)
+	fmt.Println("rendered credit note", creditNote, "of invoice", args[0], "at", path)
+	open.Run(path)
+}
@@ -0,0 +1,312 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/almost_cc/govoice/cmd/helpers"
+	gv "gitlab.com/almost_cc/govoice/invoice"
+)
+
+// customerCmd represents the customer command
+var customerCmd = &cobra.Command{
+	Use:   "customer",
+	Short: "manage the customer address book",
+	Long: `manage the address book of the customers, stored encrypted in the workspace.
+
+Every customer has a stable id, derived from the name when not given with --id,
+that can be referenced in the master descriptor with "customer": "ID" instead of
+filling the "to" section. When rendering, the recipient of the customer replaces
+"to" and the defaults of the customer (hourly rate, currency, tax treatment,
+payment terms, language and template) replace the ones of the master descriptor.
+
+Examples:
+govoice customer add --name "ACME GmbH" --country Germany --vat_number DE123456789 --payment_terms 30
+govoice customer list
+govoice customer show acme-gmbh
+govoice customer edit acme-gmbh --hourly_rate 60 --currency EUR
+govoice customer rm acme-gmbh
+`,
+}
+
+// customerAddCmd represents the customer add command
+var customerAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "add a customer to the address book",
+	Run:   customerAdd,
+}
+
+// customerListCmd represents the customer list command
+var customerListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list the customers of the address book",
+	Run:   customerList,
+}
+
+// customerShowCmd represents the customer show command
+var customerShowCmd = &cobra.Command{
+	Use:   "show CUSTOMER_ID",
+	Short: "show a customer of the address book",
+	Run:   customerShow,
+}
+
+// customerEditCmd represents the customer edit command
+var customerEditCmd = &cobra.Command{
+	Use:   "edit CUSTOMER_ID",
+	Short: "change the data of a customer, only the flags given are changed",
+	Run:   customerEdit,
+}
+
+// customerRmCmd represents the customer rm command
+var customerRmCmd = &cobra.Command{
+	Use:   "rm CUSTOMER_ID",
+	Short: "remove a customer from the address book",
+	Run:   customerRm,
+}
+
+func init() {
+	RootCmd.AddCommand(customerCmd)
+	customerCmd.AddCommand(customerAddCmd)
+	customerCmd.AddCommand(customerListCmd)
+	customerCmd.AddCommand(customerShowCmd)
+	customerCmd.AddCommand(customerEditCmd)
+	customerCmd.AddCommand(customerRmCmd)
+
+	customerAddCmd.Flags().String("id", "", "id of the customer, derived from the name if missing")
+	customerFlags(customerAddCmd)
+	customerFlags(customerEditCmd)
+}
+
+// customerFlags adds the flags of the customer data to a command
+func customerFlags(cmd *cobra.Command) {
+	cmd.Flags().String("name", "", "name of the customer")
+	cmd.Flags().String("address", "", "address")
+	cmd.Flags().String("city", "", "city")
+	cmd.Flags().String("area_code", "", "area code")
+	cmd.Flags().String("country", "", "country")
+	cmd.Flags().String("tax_id", "", "tax id")
+	cmd.Flags().String("vat_number", "", "vat number")
+	cmd.Flags().String("email", "", "email")
+	cmd.Flags().Float64("hourly_rate", 0, "default price of the items")
+	cmd.Flags().String("currency", "", "default currency of the invoices (ISO 4217 code)")
+	cmd.Flags().String("tax_treatment", "", "default tax treatment: "+strings.Join(gv.TaxTreatments, ", "))
+	cmd.Flags().String("exemption_reason", "", "reason of the exempt tax treatment")
+	cmd.Flags().Int("payment_terms", 0, "days from the invoice date to the due date")
+	cmd.Flags().String("lang", "", "language of the invoices")
+	cmd.Flags().String("template", "", "template of the invoices")
+}
+
+// setCustomerFlags sets the data of the customer from the flags given in the command line
+func setCustomerFlags(cmd *cobra.Command, c *gv.Customer) {
+	strs := map[string]*string{
+		"name":             &c.Recipient.Name,
+		"address":          &c.Recipient.Address,
+		"city":             &c.Recipient.City,
+		"area_code":        &c.Recipient.AreaCode,
+		"country":          &c.Recipient.Country,
+		"tax_id":           &c.Recipient.TaxId,
+		"vat_number":       &c.Recipient.VatNumber,
+		"email":            &c.Recipient.Email,
+		"currency":         &c.Currency,
+		"tax_treatment":    &c.TaxTreatment,
+		"exemption_reason": &c.ExemptionReason,
+		"lang":             &c.Language,
+		"template":         &c.Template,
+	}
+	for name, v := range strs {
+		if cmd.Flags().Changed(name) {
+			*v, _ = cmd.Flags().GetString(name)
+		}
+	}
+	if cmd.Flags().Changed("hourly_rate") {
+		c.HourlyRate, _ = cmd.Flags().GetFloat64("hourly_rate")
+	}
+	if cmd.Flags().Changed("payment_terms") {
+		c.PaymentTerms, _ = cmd.Flags().GetInt("payment_terms")
+	}
+}
+
+func customerAdd(cmd *cobra.Command, args []string) {
+
+	password, err := gv.ReadPassword("Enter password:")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	registry, err := gv.ReadCustomerRegistry(password)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	var c gv.Customer
+	c.Id, _ = cmd.Flags().GetString("id")
+	setCustomerFlags(cmd, &c)
+	id, err := registry.Add(c)
+	if err != nil {
+		fmt.Println("customer not added:", err)
+		return
+	}
+	if err = gv.WriteCustomerRegistry(&registry, password); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("added customer", id)
+}
+
+func customerList(cmd *cobra.Command, args []string) {
+
+	password, err := gv.ReadPassword("Enter password:")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	registry, err := gv.ReadCustomerRegistry(password)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	table := &helpers.TableData{}
+	table.SetHeader("Id", "Name", "Country", "Vat number", "Currency", "Terms")
+	for _, c := range registry.Customers {
+		terms := ""
+		if c.PaymentTerms > 0 {
+			terms = fmt.Sprint(c.PaymentTerms, " days")
+		}
+		table.AddRow(c.Id, c.Recipient.Name, c.Recipient.Country, c.Recipient.VatNumber, c.Currency, terms)
+	}
+	helpers.RenderTable(table)
+	fmt.Println(len(registry.Customers), "customers")
+}
+
+func customerShow(cmd *cobra.Command, args []string) {
+
+	if len(args) != 1 {
+		fmt.Println(cmd.Name(), "requires parameter CUSTOMER_ID")
+		cmd.Help()
+		return
+	}
+
+	password, err := gv.ReadPassword("Enter password:")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	registry, err := gv.ReadCustomerRegistry(password)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	c, err := registry.Get(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	table := &helpers.TableData{}
+	table.SetHeader("Field", "Value")
+	table.AddRow("id", c.Id)
+	table.AddRow("name", c.Recipient.Name)
+	table.AddRow("address", c.Recipient.Address)
+	table.AddRow("city", c.Recipient.City)
+	table.AddRow("area_code", c.Recipient.AreaCode)
+	table.AddRow("country", c.Recipient.Country)
+	table.AddRow("tax_id", c.Recipient.TaxId)
+	table.AddRow("vat_number", c.Recipient.VatNumber)
+	table.AddRow("email", c.Recipient.Email)
+	table.AddRow("hourly_rate", strconv.FormatFloat(c.HourlyRate, 'f', -1, 64))
+	table.AddRow("currency", c.Currency)
+	table.AddRow("tax_treatment", c.TaxTreatment)
+	table.AddRow("exemption_reason", c.ExemptionReason)
+	table.AddRow("payment_terms", strconv.Itoa(c.PaymentTerms))
+	table.AddRow("lang", c.Language)
+	table.AddRow("template", c.Template)
+	helpers.RenderTable(table)
+}
+
+func customerEdit(cmd *cobra.Command, args []string) {
+
+	if len(args) != 1 {
+		fmt.Println(cmd.Name(), "requires parameter CUSTOMER_ID")
+		cmd.Help()
+		return
+	}
+
+	password, err := gv.ReadPassword("Enter password:")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	registry, err := gv.ReadCustomerRegistry(password)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	c, err := registry.Get(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	edited := *c
+	setCustomerFlags(cmd, &edited)
+	if err = edited.Validate(); err != nil {
+		fmt.Println("customer not changed:", err)
+		return
+	}
+	*c = edited
+	if err = gv.WriteCustomerRegistry(&registry, password); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("changed customer", c.Id)
+}
+
+func customerRm(cmd *cobra.Command, args []string) {
+
+	if len(args) != 1 {
+		fmt.Println(cmd.Name(), "requires parameter CUSTOMER_ID")
+		cmd.Help()
+		return
+	}
+
+	password, err := gv.ReadPassword("Enter password:")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	registry, err := gv.ReadCustomerRegistry(password)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err = registry.Remove(args[0]); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if reply := gv.ReadUserInput(fmt.Sprint("remove the customer ", args[0], "? [yes/no] no")); reply != "yes" {
+		fmt.Println("ok, nothing to do")
+		return
+	}
+	if err = gv.WriteCustomerRegistry(&registry, password); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("removed customer", args[0], ", the invoices already rendered are not changed")
+}
@@ -1,7 +1,12 @@
 package helpers
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
 	"os"
+	"strings"
 
 	"github.com/olekukonko/tablewriter"
 )
@@ -24,6 +29,20 @@ func (td *TableData) SetFooter(elements ...string) {
 	td.Footer = elements
 }
 
+// currencySymbols are the symbols of the most common currencies
+var currencySymbols = map[string]string{
+	"EUR": "€", "USD": "$", "GBP": "£", "JPY": "¥", "CHF": "CHF ", "INR": "₹",
+}
+
+// CurrencySymbol returns the symbol of an ISO 4217 currency for amount formatting,
+// the code itself for the currencies without a known symbol
+func CurrencySymbol(code string) string {
+	if s, exists := currencySymbols[code]; exists {
+		return s
+	}
+	return code + " "
+}
+
 func RenderTable(dt *TableData) {
 	// output results to console as a table
 	table := tablewriter.NewWriter(os.Stdout)
@@ -37,3 +56,44 @@ func RenderTable(dt *TableData) {
 	// render the output
 	table.Render()
 }
+
+// RenderCSV writes the table to the console as CSV, the footer is the last record
+func RenderCSV(dt *TableData) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write(dt.Header)
+	w.WriteAll(dt.Data)
+	if len(dt.Footer) > 0 {
+		w.Write(dt.Footer)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// RenderJSON writes a value to the console as indented JSON
+func RenderJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// RenderBarChart writes an horizontal ascii bar chart to the console, the longest bar
+// is width characters, the negative values are drawn with '-'
+func RenderBarChart(labels []string, values []float64, valueLabels []string, width int) {
+	max, pad := 0.0, 0
+	for i, v := range values {
+		max = math.Max(max, math.Abs(v))
+		if len(labels[i]) > pad {
+			pad = len(labels[i])
+		}
+	}
+	for i, v := range values {
+		bar, n := "#", 0
+		if v < 0 {
+			bar = "-"
+		}
+		if max > 0 {
+			n = int(math.Round(math.Abs(v) / max * float64(width)))
+		}
+		fmt.Printf("%-*s | %s %s\n", pad, labels[i], strings.Repeat(bar, n), valueLabels[i])
+	}
+}
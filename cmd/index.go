@@ -47,9 +47,10 @@ func init() {
 func index(cmd *cobra.Command, args []string) {
 
 	// retrieve password
-	password, err := gv.ReadUserPassword("Enter password:")
+	password, err := gv.ReadPassword("Enter password:")
 	if err != nil {
 		fmt.Println(err)
+		return
 	}
 	// create the index
 	count, elapsed, err := gv.RebuildSearchIndex(password)
@@ -52,7 +52,7 @@ func info(cmd *cobra.Command, args []string) {
 	table.SetHeader("Desc", "Path")
 	table.AddRow("$HOME", config.GetConfigHome())
 	table.AddRow("Config", config.GetConfigFilePath())
-	table.AddRow("Workspace", config.Main.Workspace)
+	table.AddRow("Workspace", config.Govoice.Workspace)
 	table.AddRow("Master descriptor", mp)
 	helpers.RenderTable(table)
 	println()
@@ -0,0 +1,52 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/almost_cc/govoice/config"
+	gv "gitlab.com/almost_cc/govoice/invoice"
+)
+
+// keygenCmd represents the keygen command
+var keygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "generate the identity used to decrypt the descriptors encrypted for recipients",
+	Long: `generate a new X25519 identity and write it to the identity file
+(CONFIG_HOME/identity.txt or identityFile in the configuration).
+
+The public key printed at the end can be added to the recipients in the configuration
+of everyone sharing the workspace, then run govoice rewrap to encrypt the descriptors for it.
+The identity file is never overwritten.
+`,
+	Run: keygen,
+}
+
+func init() {
+	RootCmd.AddCommand(keygenCmd)
+}
+
+func keygen(cmd *cobra.Command, args []string) {
+	public, err := gv.CreateIdentityFile()
+	if err != nil {
+		fmt.Println("identity not created:", err)
+		return
+	}
+	identityPath, _ := config.GetIdentityFilePath()
+	fmt.Println("identity written to", identityPath)
+	fmt.Println("public key:", public)
+}
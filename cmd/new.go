@@ -0,0 +1,85 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/almost_cc/govoice/config"
+	gv "gitlab.com/almost_cc/govoice/invoice"
+)
+
+// newCmd represents the new command
+var newCmd = &cobra.Command{
+	Use:   "new",
+	Short: "write the next invoice in the master descriptor",
+	Long: `write the next invoice in the master descriptor, starting from the master
+descriptor (the last invoice rendered) or from an invoice of the workspace with --from.
+
+The new invoice has the next number of the sequence (or, when the numberPattern is not
+configured, the highest number of the workspace incremented), today as date, the due date after the
+defaultInvoiceNet days of the configuration (or the payment terms of the customer)
+and no items, unless --keep_items is given.
+
+The master descriptor is not overwritten if it has not been rendered, unless --force is given.
+
+Examples:
+govoice new                                 // the next invoice of the same customer
+govoice new --customer acme-gmbh            // the next invoice for a customer of the address book
+govoice new --from 2026-0012 --keep_items   // copy an invoice with its items
+`,
+	Run: newInvoice,
+}
+
+func init() {
+	RootCmd.AddCommand(newCmd)
+
+	newCmd.Flags().String("customer", "", "id of the customer of the new invoice")
+	newCmd.Flags().String("from", "", "number of the invoice to start from, defaults to the master descriptor")
+	newCmd.Flags().Bool("keep_items", false, "copy the items of the invoice")
+	newCmd.Flags().Bool("force", false, "overwrite the master descriptor even if it has not been rendered")
+}
+
+func newInvoice(cmd *cobra.Command, args []string) {
+
+	var opts gv.NewInvoiceOptions
+	opts.From, _ = cmd.Flags().GetString("from")
+	opts.Customer, _ = cmd.Flags().GetString("customer")
+	opts.KeepItems, _ = cmd.Flags().GetBool("keep_items")
+	opts.Force, _ = cmd.Flags().GetBool("force")
+
+	// the password is needed only to read an invoice or the customers
+	var password string
+	masterCustomer, _ := gv.MasterCustomer()
+	if opts.From != "" || opts.Customer != "" || masterCustomer != "" {
+		var err error
+		if password, err = gv.ReadPassword("Enter password:"); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	invoice, err := gv.NewInvoice(opts, password)
+	if err != nil {
+		fmt.Println("invoice not created:", err)
+		return
+	}
+	masterPath, _ := config.GetMasterPath()
+	if invoice.Invoice.Number == "" {
+		fmt.Println("set the invoice number in", masterPath)
+	}
+	fmt.Println("new invoice", invoice.Invoice.Number, "for", invoice.To.Name, "dated", invoice.Invoice.Date, "due", invoice.Invoice.Due, "in", masterPath)
+}
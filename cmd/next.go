@@ -0,0 +1,66 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	gv "gitlab.com/almost_cc/govoice/invoice"
+)
+
+// nextCmd represents the next command
+var nextCmd = &cobra.Command{
+	Use:   "next",
+	Short: "print the next invoice number of the sequence",
+	Long: `compute the next invoice number using the numberPattern of the configuration
+and the invoices in the workspace.
+
+When the number of the master descriptor is empty, render assigns the next number automatically.
+
+Examples:
+govoice next                  // print the next number
+govoice next --series credit  // print the next number of the credit series
+govoice next --assign         // set the next number in the master descriptor
+`,
+	Run: next,
+}
+
+func init() {
+	RootCmd.AddCommand(nextCmd)
+
+	nextCmd.Flags().String("series", "", "series of the number, defaults to the default series")
+	nextCmd.Flags().Bool("assign", false, "set the number in the master descriptor, using its series and date")
+}
+
+func next(cmd *cobra.Command, args []string) {
+	if assign, _ := cmd.Flags().GetBool("assign"); assign {
+		number, err := gv.AssignMasterNumber()
+		if err != nil {
+			fmt.Println("number not assigned:", err)
+			return
+		}
+		fmt.Println("assigned invoice number", number, "to the master descriptor")
+		return
+	}
+	series, _ := cmd.Flags().GetString("series")
+	number, err := gv.NextInvoiceNumber(series, time.Now())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(number)
+}
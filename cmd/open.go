@@ -44,5 +44,5 @@ func init() {
 }
 
 func doOpen(cmd *cobra.Command, args []string) {
-	open.Run(config.Main.Workspace)
+	open.Run(config.Govoice.Workspace)
 }
@@ -0,0 +1,104 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/leekchan/accounting"
+	"github.com/spf13/cobra"
+	"gitlab.com/almost_cc/govoice/cmd/helpers"
+	"gitlab.com/almost_cc/govoice/config"
+	gv "gitlab.com/almost_cc/govoice/invoice"
+)
+
+// payCmd represents the pay command
+var payCmd = &cobra.Command{
+	Use:   "pay INVOICE_NUMBER",
+	Short: "record a payment of an invoice",
+	Long: `record a payment received for an invoice in the payment ledger.
+The ledger is stored encrypted in the workspace, the payment status and the
+outstanding balance of the invoice are updated in the search index.
+
+Without --amount the payment is the outstanding balance of the invoice.
+The status of an invoice is one of: open, partially_paid, paid, overdue, credited.
+
+Examples:
+govoice pay 2026-0012                                    // the invoice is fully paid today
+govoice pay 2026-0012 --amount 500 --date 2026-09-30     // partial payment
+govoice pay 2026-0012 --amount 500 --method transfer     // payment method
+govoice pay 2026-0012 --show                             // show the payments and the status
+`,
+	Run: pay,
+}
+
+func init() {
+	RootCmd.AddCommand(payCmd)
+
+	payCmd.Flags().Float64("amount", 0, "amount paid, defaults to the outstanding balance")
+	payCmd.Flags().String("date", time.Now().Format(config.QueryDateFormat), "payment date")
+	payCmd.Flags().String("method", "", "payment method (ex. transfer, cash)")
+	payCmd.Flags().Bool("show", false, "show the payments of the invoice without recording a payment")
+}
+
+func pay(cmd *cobra.Command, args []string) {
+
+	if len(args) != 1 {
+		fmt.Println(cmd.Name(), "requires parameter INVOICE_NUMBER")
+		cmd.Help()
+		return
+	}
+
+	password, err := gv.ReadPassword("Enter password:")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	var status gv.PaymentStatus
+	if show, _ := cmd.Flags().GetBool("show"); show {
+		if status, err = gv.GetPaymentStatus(args[0], password); err != nil {
+			fmt.Println(err)
+			return
+		}
+	} else {
+		ds, _ := cmd.Flags().GetString("date")
+		date, err := time.Parse(config.QueryDateFormat, ds)
+		if err != nil {
+			fmt.Println("unrecognized date", ds)
+			return
+		}
+		amount, _ := cmd.Flags().GetFloat64("amount")
+		method, _ := cmd.Flags().GetString("method")
+		if status, err = gv.RecordPayment(args[0], amount, date, method, password); err != nil {
+			fmt.Println("payment not recorded:", err)
+			return
+		}
+	}
+
+	// for amount formatting
+	ac := accounting.Accounting{Symbol: helpers.CurrencySymbol(status.Currency), Precision: gv.CurrencyDecimals(status.Currency)}
+	table := &helpers.TableData{}
+	table.SetHeader("Date", "Method", "Amount")
+	for _, p := range status.Payments {
+		table.AddRow(p.Date.Format(config.QueryDateFormat), p.Method, ac.FormatMoney(p.Amount.Float64()))
+	}
+	table.SetFooter("", "Paid", ac.FormatMoney(status.Paid.Float64()))
+	helpers.RenderTable(table)
+
+	fmt.Println("invoice", status.Number, "is", status.Status, "- total", ac.FormatMoney(status.Total.Float64()),
+		"due", status.Due.Format(config.QueryDateFormat), "outstanding", ac.FormatMoney(status.Outstanding.Float64()))
+}
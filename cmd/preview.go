@@ -28,7 +28,7 @@ import (
 var previewCmd = &cobra.Command{
 	Use:   "preview",
 	Short: "render a preview of the pdf",
-	Long:  `works like render but doesn't asks for passwords and owerwrite existing files`,
+	Long:  `works like render but doesn't asks for passwords (unless the master references a customer) and owerwrite existing files`,
 	Run:   preview,
 }
 
@@ -49,8 +49,17 @@ func preview(cmd *cobra.Command, args []string) {
 		return
 	}
 	fmt.Println("template is ", templatePath)
+	// the password is needed only to read the customer of the master descriptor
+	var password string
+	if id, _ := govoice.MasterCustomer(); id != "" {
+		var err error
+		if password, err = govoice.ReadPassword("Enter password:"); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
 	// render invoice
-	if invoiceNumber, err := govoice.PreviewInvoice(templatePath); err == govoice.InvoiceDescriptorExists {
+	if invoiceNumber, err := govoice.PreviewInvoice(password, templatePath); err == govoice.InvoiceDescriptorExists {
 		fmt.Println("ok, nothing to do")
 	} else if err != nil {
 		fmt.Println("error rendering invoice:", err)
@@ -0,0 +1,107 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/almost_cc/govoice/cmd/helpers"
+	"gitlab.com/almost_cc/govoice/config"
+	gv "gitlab.com/almost_cc/govoice/invoice"
+)
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "manage the sender profiles",
+	Long: `manage the sender profiles, to invoice for more than one business.
+
+A profile has its own sender (from), payment details, numbering, default template,
+workspace and search index. The profiles are stored in CONFIG_HOME/profiles/NAME.toml,
+select one with the global flag --profile or with "profile": "NAME" in the master descriptor.
+
+Examples:
+govoice profile add gmbh --number_pattern "GMBH-{YYYY}-{SEQ:4}"  // create the profile
+govoice profile list                                          // list the profiles
+govoice --profile gmbh edit                                   // edit the master descriptor of the profile
+govoice --profile gmbh render                                 // render an invoice of the profile
+`,
+}
+
+// profileAddCmd represents the profile add command
+var profileAddCmd = &cobra.Command{
+	Use:   "add NAME",
+	Short: "create a sender profile from the master descriptor",
+	Run:   profileAdd,
+}
+
+// profileListCmd represents the profile list command
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list the sender profiles",
+	Run:   profileList,
+}
+
+func init() {
+	RootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileAddCmd)
+	profileCmd.AddCommand(profileListCmd)
+
+	profileAddCmd.Flags().String("workspace", "", "workspace of the profile, defaults to the subfolder NAME of the workspace")
+	profileAddCmd.Flags().String("template", "", "default template of the profile")
+	profileAddCmd.Flags().String("number_pattern", "", "pattern of the invoice numbers, defaults to the one of the configuration")
+}
+
+func profileAdd(cmd *cobra.Command, args []string) {
+
+	if len(args) != 1 {
+		fmt.Println(cmd.Name(), "requires parameter NAME")
+		cmd.Help()
+		return
+	}
+
+	p := gv.Profile{Name: args[0], NumberYearlyReset: config.Govoice.NumberYearlyReset}
+	p.Workspace, _ = cmd.Flags().GetString("workspace")
+	p.Template, _ = cmd.Flags().GetString("template")
+	p.NumberPattern, _ = cmd.Flags().GetString("number_pattern")
+	profilePath, err := gv.AddProfile(p)
+	if err != nil {
+		fmt.Println("profile not created:", err)
+		return
+	}
+	fmt.Println("profile created at", profilePath, ", edit it to change the sender and the payment details")
+}
+
+func profileList(cmd *cobra.Command, args []string) {
+
+	names, err := gv.ListProfiles()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	table := &helpers.TableData{}
+	table.SetHeader("Profile", "Sender", "Template", "Number pattern")
+	for _, n := range names {
+		p, err := gv.ReadProfile(n)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		table.AddRow(n, p.From.Name, p.Template, p.NumberPattern)
+	}
+	helpers.RenderTable(table)
+}
@@ -0,0 +1,125 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/almost_cc/govoice/cmd/helpers"
+	"gitlab.com/almost_cc/govoice/config"
+	gv "gitlab.com/almost_cc/govoice/invoice"
+)
+
+// ratesCmd represents the rates command
+var ratesCmd = &cobra.Command{
+	Use:   "rates",
+	Short: "manage the exchange rates of the currencies",
+	Long: `manage the local store of the euro foreign exchange reference rates
+published by the ECB, used to convert the invoices to the base currency
+at the date of the invoice.
+
+The rates are never downloaded, import the eurofxref files (daily or historical,
+XML or CSV) from https://www.ecb.europa.eu/stats/eurofxref/
+
+Examples:
+govoice rates import eurofxref-hist.zip.csv    // import the historical rates
+govoice rates import eurofxref-daily.xml       // import the daily rates
+govoice rates show                             // show the latest rates
+govoice rates show --date 2026-03-01           // show the rates at a date
+`,
+}
+
+// ratesImportCmd represents the rates import command
+var ratesImportCmd = &cobra.Command{
+	Use:   "import FILE",
+	Short: "import an ECB eurofxref file in the exchange rates store",
+	Run:   ratesImport,
+}
+
+// ratesShowCmd represents the rates show command
+var ratesShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "show the exchange rates of a date",
+	Run:   ratesShow,
+}
+
+func init() {
+	RootCmd.AddCommand(ratesCmd)
+	ratesCmd.AddCommand(ratesImportCmd)
+	ratesCmd.AddCommand(ratesShowCmd)
+
+	ratesShowCmd.Flags().String("date", "", "date of the rates, defaults to the latest rates")
+}
+
+func ratesImport(cmd *cobra.Command, args []string) {
+
+	if len(args) != 1 {
+		fmt.Println(cmd.Name(), "requires parameter FILE")
+		cmd.Help()
+		return
+	}
+
+	days, err := gv.ImportExchangeRates(args[0])
+	if err != nil {
+		fmt.Println("rates not imported:", err)
+		return
+	}
+	fmt.Println("imported the exchange rates of", days, "days")
+	fmt.Println("run govoice index to update the amounts in", gv.BaseCurrency(), "of the search index")
+}
+
+func ratesShow(cmd *cobra.Command, args []string) {
+
+	rates, err := gv.ReadExchangeRates()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	day, latest := rates.Latest()
+	if day == "" {
+		fmt.Println("no exchange rates, import them with govoice rates import")
+		return
+	}
+
+	date, _ := time.Parse(config.QueryDateFormat, day)
+	if ds, _ := cmd.Flags().GetString("date"); ds != "" {
+		if date, err = time.Parse(config.QueryDateFormat, ds); err != nil {
+			fmt.Println("unrecognized date", ds)
+			return
+		}
+	}
+
+	table := &helpers.TableData{}
+	table.SetHeader("Currency", "1 "+config.DefaultCurrency, "1 "+gv.BaseCurrency())
+	for _, c := range gv.Currencies(latest) {
+		rate, err := rates.Rate(c, date)
+		if err != nil {
+			continue
+		}
+		base, err := rates.Rate(gv.BaseCurrency(), date)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		r, _ := rate.Float64()
+		b, _ := base.Quo(rate, base).Float64()
+		table.AddRow(c, strconv.FormatFloat(r, 'f', -1, 64), strconv.FormatFloat(b, 'f', 4, 64))
+	}
+	fmt.Println("exchange rates at", date.Format(config.QueryDateFormat))
+	helpers.RenderTable(table)
+}
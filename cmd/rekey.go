@@ -0,0 +1,108 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/almost_cc/govoice/config"
+	gv "gitlab.com/almost_cc/govoice/invoice"
+)
+
+// rekeyCmd represents the rekey command
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "change the password of all the encrypted descriptors in the workspace",
+	Long: `decrypt every encrypted descriptor in the workspace with the current password
+and encrypt it again with a new one.
+
+The descriptors are modified only if all of them can be decrypted with the current password.
+The original descriptors are kept in a journal until the end of the process, if the process
+is interrupted the next run of rekey restores them before doing anything else.
+
+Examples:
+govoice rekey                // change the password
+govoice rekey --kdf_cost 17  // change the password using a more expensive key derivation
+govoice rekey --rollback     // only restore the descriptors of an interrupted rekey
+govoice rekey --password-file old.txt --new_password_file new.txt  // change the password from a script
+`,
+	Run: rekey,
+}
+
+func init() {
+	RootCmd.AddCommand(rekeyCmd)
+
+	rekeyCmd.Flags().Int("kdf_cost", 0, "scrypt cost (log2 of N) for the new encryption, defaults to the configuration")
+	rekeyCmd.Flags().Int("kdf_block_size", 0, "scrypt block size (r) for the new encryption, defaults to the configuration")
+	rekeyCmd.Flags().Int("kdf_parallelization", 0, "scrypt parallelization (p) for the new encryption, defaults to the configuration")
+	rekeyCmd.Flags().Int("envelope_version", 0, "version of the encrypted descriptor format, defaults to the latest")
+	rekeyCmd.Flags().Bool("rollback", false, "restore the descriptors of an interrupted rekey and exit")
+	// sources of the new password, the current one is read as for the other commands
+	rekeyCmd.Flags().String("new_password_file", "", "read the new password from the first line of a file")
+	rekeyCmd.Flags().String("new_password_command", "", "read the new password from the output of a command")
+	rekeyCmd.Flags().Bool("new_password_stdin", false, "read the new password from the standard input, after the current one")
+}
+
+func rekey(cmd *cobra.Command, args []string) {
+
+	// restore an interrupted run first
+	restored, err := gv.RollbackRekey()
+	if err != nil {
+		fmt.Println("error restoring the descriptors of an interrupted rekey:", err)
+		return
+	}
+	if restored {
+		fmt.Println("the descriptors of an interrupted rekey have been restored")
+	}
+	if rollback, _ := cmd.Flags().GetBool("rollback"); rollback {
+		return
+	}
+
+	var opts gv.RekeyOptions
+	opts.KdfCost, _ = cmd.Flags().GetInt("kdf_cost")
+	opts.KdfBlockSize, _ = cmd.Flags().GetInt("kdf_block_size")
+	opts.KdfParallelization, _ = cmd.Flags().GetInt("kdf_parallelization")
+	opts.EnvelopeVersion, _ = cmd.Flags().GetInt("envelope_version")
+
+	oldPassword, err := gv.ReadPassword("Enter current password:")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	var source string
+	newPasswordFile, _ := cmd.Flags().GetString("new_password_file")
+	newPasswordCommand, _ := cmd.Flags().GetString("new_password_command")
+	switch stdin, _ := cmd.Flags().GetBool("new_password_stdin"); {
+	case newPasswordFile != "":
+		source = config.PasswordSourceFile
+	case newPasswordCommand != "":
+		source = config.PasswordSourceCommand
+	case stdin:
+		source = config.PasswordSourceStdin
+	}
+	newPassword, err := gv.ReadNewPassword(source, newPasswordFile, newPasswordCommand)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	count, err := gv.RekeyWorkspace(oldPassword, newPassword, opts)
+	if err != nil {
+		fmt.Println("password not changed:", err)
+		return
+	}
+	fmt.Println("password changed for", count, "descriptors")
+}
@@ -49,7 +49,7 @@ func init() {
 func render(cmd *cobra.Command, args []string) {
 
 	// read the password
-	password, err := govoice.ReadUserPassword("Enter password:")
+	password, err := govoice.ReadPassword("Enter password:")
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -0,0 +1,65 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/almost_cc/govoice/cmd/helpers"
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "print reports about the invoices",
+	Long: `print reports about the invoices in the workspace.
+
+The reports can be printed as a console table, as CSV or as JSON with --format.
+
+Examples:
+govoice report aging                 // accounts receivable aging
+govoice report aging --format csv    // aging report as CSV
+govoice report revenue               // revenue by month
+govoice report vat --period 2026-Q3  // vat return of the third quarter
+`,
+}
+
+func init() {
+	RootCmd.AddCommand(reportCmd)
+
+	reportCmd.PersistentFlags().StringP("format", "o", config.ReportFormatTable, "output format: table, csv, json or chart (revenue only)")
+}
+
+// renderReport prints a report in the format of the --format flag,
+// the table is used for table and csv, the report value for json
+func renderReport(cmd *cobra.Command, table *helpers.TableData, report interface{}) {
+	format, _ := cmd.Flags().GetString("format")
+	var err error
+	switch format {
+	case config.ReportFormatTable:
+		helpers.RenderTable(table)
+	case config.ReportFormatCSV:
+		err = helpers.RenderCSV(table)
+	case config.ReportFormatJSON:
+		err = helpers.RenderJSON(report)
+	default:
+		err = fmt.Errorf("unknown format '%s', use table, csv or json", format)
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -64,7 +64,7 @@ func restore(cmd *cobra.Command, args []string) {
 	}
 
 	// read user password for decrypt
-	password, err := gv.ReadUserPassword("Enter password:")
+	password, err := gv.ReadPassword("Enter password:")
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -0,0 +1,139 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leekchan/accounting"
+	"github.com/spf13/cobra"
+	"gitlab.com/almost_cc/govoice/cmd/helpers"
+	"gitlab.com/almost_cc/govoice/config"
+	gv "gitlab.com/almost_cc/govoice/invoice"
+)
+
+// revenueCmd represents the report revenue command
+var revenueCmd = &cobra.Command{
+	Use:   "revenue",
+	Short: "revenue report by period and customer",
+	Long: `the net, tax and gross totals of the invoices grouped by period
+(month, quarter, year or none) and/or by customer.
+The credit notes are subtracted from the revenue of their period.
+
+Besides table, csv and json the report can be printed as a bar chart of
+the gross totals with --format chart.
+
+The report uses the search index, run govoice index if the index is not up to date.
+
+Examples:
+govoice report revenue                                    // revenue by month
+govoice report revenue --period quarter -f 2026-01-01     // revenue by quarter since 2026
+govoice report revenue --period none --by_customer        // revenue by customer
+govoice report revenue --period year --format chart       // bar chart of the revenue by year
+`,
+	Run: revenue,
+}
+
+func init() {
+	reportCmd.AddCommand(revenueCmd)
+
+	iq := gv.DefaultInvoiceQuery()
+	revenueCmd.Flags().StringP("date_from", "f", iq.DateFrom.Format(config.QueryDateFormat), "date range from (default 1970-01-01")
+	revenueCmd.Flags().StringP("date_to", "t", iq.DateTo.Format(config.QueryDateFormat), "date range to (default today)")
+	revenueCmd.Flags().IntP("months", "m", 0, "months, now - $months range, (has precedence over date ranges)")
+	revenueCmd.Flags().String("period", config.PeriodMonth, "group by period: month, quarter, year or none")
+	revenueCmd.Flags().Bool("by_customer", false, "group by customer")
+}
+
+func revenue(cmd *cobra.Command, args []string) {
+
+	// get the date_from/date_to range
+	df, _ := cmd.Flags().GetString("date_from")
+	from, err := time.Parse(config.QueryDateFormat, df)
+	if err != nil {
+		fmt.Println("unrecognized date", df)
+		return
+	}
+	dt, _ := cmd.Flags().GetString("date_to")
+	to, err := time.Parse(config.QueryDateFormat, dt)
+	if err != nil {
+		fmt.Println("unrecognized date", dt)
+		return
+	}
+	// get the months range
+	if m, _ := cmd.Flags().GetInt("months"); m > 0 {
+		from = time.Now().AddDate(0, m*-1, 0)
+	}
+
+	period, _ := cmd.Flags().GetString("period")
+	byCustomer, _ := cmd.Flags().GetBool("by_customer")
+	report, err := gv.GetRevenueReport(from, to, period, byCustomer)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	format, _ := cmd.Flags().GetString("format")
+	// for amount formatting, plain numbers in csv
+	ac := accounting.Accounting{Symbol: helpers.CurrencySymbol(report.Currency), Precision: gv.CurrencyDecimals(report.Currency)}
+	amount := ac.FormatMoney
+	if format == config.ReportFormatCSV {
+		amount = func(v interface{}) string { return strconv.FormatFloat(v.(float64), 'f', ac.Precision, 64) }
+	}
+
+	if format == config.ReportFormatChart {
+		var labels, values []string
+		var gross []float64
+		for _, r := range report.Rows {
+			labels = append(labels, strings.TrimSpace(r.Period+" "+r.Customer))
+			gross = append(gross, r.Gross)
+			values = append(values, amount(r.Gross))
+		}
+		helpers.RenderBarChart(labels, gross, values, 50)
+		return
+	}
+
+	table := &helpers.TableData{}
+	var header []string
+	if period != config.PeriodNone {
+		header = append(header, "Period")
+	}
+	if byCustomer {
+		header = append(header, "Customer")
+	}
+	table.SetHeader(append(header, "Invoices", "Net", "Tax", "Gross")...)
+	row := func(r gv.RevenueRow) (cells []string) {
+		if period != config.PeriodNone {
+			cells = append(cells, r.Period)
+		}
+		if byCustomer {
+			cells = append(cells, r.Customer)
+		}
+		return append(cells, strconv.Itoa(r.Invoices), amount(r.Net), amount(r.Tax), amount(r.Gross))
+	}
+	for _, r := range report.Rows {
+		table.AddRow(row(r)...)
+	}
+	totals := row(report.Totals)
+	if len(header) > 0 {
+		totals[0] = "Total"
+	}
+	table.SetFooter(totals...)
+
+	renderReport(cmd, table, report)
+}
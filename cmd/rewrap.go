@@ -0,0 +1,71 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	gv "gitlab.com/almost_cc/govoice/invoice"
+)
+
+// rewrapCmd represents the rewrap command
+var rewrapCmd = &cobra.Command{
+	Use:   "rewrap",
+	Short: "encrypt all the descriptors in the workspace for the recipients in the configuration",
+	Long: `encrypt every descriptor in the workspace for the recipients listed in the configuration.
+
+Descriptors already encrypted for recipients get only a new header, the invoice data is not
+re-encrypted, so adding or removing a recipient is fast. Descriptors encrypted with a password
+are decrypted and encrypted for the recipients, the password is asked only in this case.
+
+Like rekey the original descriptors are kept in a journal until the end of the process,
+use govoice rekey --rollback to restore them if the process is interrupted.
+
+Examples:
+govoice rewrap   // after adding or removing a public key from the recipients
+`,
+	Run: rewrap,
+}
+
+func init() {
+	RootCmd.AddCommand(rewrapCmd)
+}
+
+func rewrap(cmd *cobra.Command, args []string) {
+	needsPassword, err := gv.WorkspaceNeedsPassword()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	var password string
+	if needsPassword {
+		p, err := gv.GetPasswordProvider()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if password, err = p.ReadPassword("Enter password:"); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	count, err := gv.RewrapWorkspace(password)
+	if err != nil {
+		fmt.Println("descriptors not changed:", err)
+		return
+	}
+	fmt.Println("descriptors encrypted for the recipients:", count)
+}
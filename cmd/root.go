@@ -22,6 +22,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"gitlab.com/almost_cc/govoice/config"
+	gv "gitlab.com/almost_cc/govoice/invoice"
 )
 
 // RootCmd represents the base command when called without any subcommands
@@ -38,6 +39,16 @@ It offers:
 	//	Run: func(cmd *cobra.Command, args []string) { },
 }
 
+// password source flags
+var (
+	passwordFile    string
+	passwordCommand string
+	passwordStdin   bool
+)
+
+// profile is the sender profile selected with --profile
+var profile string
+
 // Execute adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -55,6 +66,12 @@ func init() {
 	// will be global for your application.
 
 	RootCmd.PersistentFlags().BoolVar(&config.DebugEnabled, "debug", false, "enable debug log")
+	// password sources, they override the passwordSource configuration
+	RootCmd.PersistentFlags().StringVar(&passwordFile, "password-file", "", "read the password from the first line of a file")
+	RootCmd.PersistentFlags().StringVar(&passwordCommand, "password-command", "", "read the password from the output of a command (ex. 'pass show invoices')")
+	RootCmd.PersistentFlags().BoolVar(&passwordStdin, "password-stdin", false, "read the password from the standard input")
+	// sender profile, with its own workspace and search index
+	RootCmd.PersistentFlags().StringVar(&profile, "profile", "", "sender profile to use (see govoice profile)")
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	// RootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
@@ -76,9 +93,27 @@ func initConfig() {
 	if err := viper.ReadInConfig(); err == nil {
 		log.Println("d: Using config file:", viper.ConfigFileUsed())
 		// load configurations (overwrited defautls)
-		viper.Unmarshal(&config.Main)
+		viper.Unmarshal(&config.Govoice)
 		//log.Println("t: config", spew.Sdump(config.Db, config.Authority, config.RestAPI, config.Chats))
 	} else {
 		log.Fatalln("a: configuration file not found", err)
 	}
+	// password source from the command line
+	switch {
+	case passwordFile != "":
+		config.Govoice.PasswordSource = config.PasswordSourceFile
+		config.Govoice.PasswordFile = passwordFile
+	case passwordCommand != "":
+		config.Govoice.PasswordSource = config.PasswordSourceCommand
+		config.Govoice.PasswordCommand = passwordCommand
+	case passwordStdin:
+		config.Govoice.PasswordSource = config.PasswordSourceStdin
+	}
+	// sender profile from the command line
+	if profile != "" {
+		if _, err := gv.UseProfile(profile); err != nil {
+			log.Fatalln("a: cannot use the profile", err)
+		}
+		log.Println("d: using profile", profile, "with workspace", config.Govoice.Workspace)
+	}
 }
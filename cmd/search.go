@@ -35,10 +35,19 @@ var searchCmd = &cobra.Command{
 - Date: invoice date
 - Number: invoice number
 - Amount: invoice subtotal
+- Tax: invoice taxes
+- Taxes.Rate / Taxes.Base / Taxes.Amount: taxable amount and tax for each tax rate
+- Status / Due / Total / Paid / Outstanding: payment status of the invoice
+- Currency: currency of the invoice (ISO 4217 code)
+- BaseAmount / BaseTax / BaseTotal / BaseOutstanding: amounts converted to the base currency
+
+the amount range flags and the total of the results are in the base currency
 
 examples of queries are
 
 govoice search "Amount:>1000" // search for invoices with amount greather than 1000
+govoice search --tax_rate 7     // search for invoices with items taxed at 7%
+govoice search --status overdue // search for unpaid invoices after the due date
 govoice search wolskwagen  // full text search on all field for wolkswagen
 
 the full text search is provided by bleve, visit the bleve documentation for query examples
@@ -65,6 +74,8 @@ func init() {
 	searchCmd.Flags().IntP("months", "m", 0, "months, now - $months range, (has precedence over date ranges)")
 	searchCmd.Flags().Float64P("amount_greater_equal", "g", iq.AmountGE, "Amount greater or equals to")
 	searchCmd.Flags().Float64P("amount_lower_equal", "l", iq.AmountLE, "Amount lower or equals to")
+	searchCmd.Flags().Float64("tax_rate", iq.TaxRate, "only invoices with items at this tax rate (ex. 7)")
+	searchCmd.Flags().String("status", iq.Status, "only invoices with this payment status (open, partially_paid, paid, overdue, credited)")
 
 }
 
@@ -83,6 +94,10 @@ func search(cmd *cobra.Command, args []string) {
 	// get the amount range
 	iq.AmountLE, _ = cmd.Flags().GetFloat64("amount_lower_equal")
 	iq.AmountGE, _ = cmd.Flags().GetFloat64("amount_greater_equal")
+	// get the tax rate
+	iq.TaxRate, _ = cmd.Flags().GetFloat64("tax_rate")
+	// get the payment status
+	iq.Status, _ = cmd.Flags().GetString("status")
 
 	// get the date_from/date_to range
 	df, _ := cmd.Flags().GetString("date_from")
@@ -110,9 +125,9 @@ func search(cmd *cobra.Command, args []string) {
 
 	// output results to console as a table
 	table := &helpers.TableData{}
-	table.SetHeader("File", "Number", "Customer", "Date", "Amount")
-	// for amount formatting
-	ac := accounting.Accounting{Symbol: "€", Precision: 2}
+	table.SetHeader("Number", "Customer", "Date", "Amount", "Tax", "Status", "Outstanding", "File")
+	// for amount formatting, the total is in the base currency
+	ac := accounting.Accounting{Symbol: helpers.CurrencySymbol(gv.BaseCurrency()), Precision: gv.CurrencyDecimals(gv.BaseCurrency())}
 
 	fmt.Println("query:", iq.String())
 	fmt.Println("found", total, "results in", elapsed)
@@ -122,15 +137,20 @@ func search(cmd *cobra.Command, args []string) {
 
 	for _, e := range entries {
 		path, _ := config.GetInvoicePdfPath(e.Number)
+		// the amounts of the invoice in its currency
+		acr := accounting.Accounting{Symbol: helpers.CurrencySymbol(e.Currency), Precision: gv.CurrencyDecimals(e.Currency)}
 		table.AddRow(
 			e.Number,
 			e.Customer,
 			e.Date.Format(config.QueryDateFormat),
-			ac.FormatMoney(e.Amount),
+			acr.FormatMoney(e.Amount),
+			acr.FormatMoney(e.Tax),
+			e.CurrentStatus(),
+			acr.FormatMoney(e.Outstanding),
 			path,
 		)
 	}
-	table.SetFooter("", "", "Total", ac.FormatMoney(amountTotal), "") // Add Footer
+	table.SetFooter("", "", "Total", ac.FormatMoney(amountTotal), "", "", "", "") // Add Footer
 	helpers.RenderTable(table)
 
 }
@@ -0,0 +1,101 @@
+// Copyright © 2017 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/leekchan/accounting"
+	"github.com/spf13/cobra"
+	"gitlab.com/almost_cc/govoice/cmd/helpers"
+	"gitlab.com/almost_cc/govoice/config"
+	gv "gitlab.com/almost_cc/govoice/invoice"
+)
+
+// vatCmd represents the report vat command
+var vatCmd = &cobra.Command{
+	Use:   "vat",
+	Short: "vat return report of a filing period",
+	Long: `the net amount and the tax collected for every tax rate in a filing period,
+split between domestic, intra EU (reverse charge) and export customers.
+
+The category of a customer is derived from the vat number and the country:
+- intra_eu: customers with an EU vat number of another country
+- domestic: customers of the same country and EU customers without a vat number
+- export: customers outside the EU
+
+The descriptors of the workspace are decrypted to compute the report,
+the credit notes are subtracted in the period of their date.
+
+Examples:
+govoice report vat --period 2026-Q3                // third quarter of 2026
+govoice report vat --period 2026-07                // july 2026
+govoice report vat --period 2026 --format json     // year 2026 as JSON
+`,
+	Run: vat,
+}
+
+func init() {
+	reportCmd.AddCommand(vatCmd)
+
+	vatCmd.Flags().String("period", "", "filing period: a year (2026), a quarter (2026-Q3) or a month (2026-07)")
+}
+
+func vat(cmd *cobra.Command, args []string) {
+
+	period, _ := cmd.Flags().GetString("period")
+	if _, _, err := gv.ParseVatPeriod(period); err != nil {
+		fmt.Println(err)
+		cmd.Help()
+		return
+	}
+
+	password, err := gv.ReadPassword("Enter password:")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	report, err := gv.GetVatReport(period, password)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	format, _ := cmd.Flags().GetString("format")
+	// for amount formatting, plain numbers in csv
+	ac := accounting.Accounting{Symbol: helpers.CurrencySymbol(report.Currency), Precision: gv.CurrencyDecimals(report.Currency)}
+	amount := ac.FormatMoney
+	if format == config.ReportFormatCSV {
+		amount = func(v interface{}) string { return strconv.FormatFloat(v.(float64), 'f', ac.Precision, 64) }
+	}
+
+	table := &helpers.TableData{}
+	table.SetHeader("Category", "Rate", "Invoices", "Net", "Tax")
+	for _, r := range report.Rows {
+		table.AddRow(r.Category, fmt.Sprintf("%.2f %%", r.Rate), strconv.Itoa(r.Invoices), amount(r.Net), amount(r.Tax))
+	}
+	// totals by category
+	for _, r := range report.Categories {
+		table.AddRow("total "+r.Category, "", strconv.Itoa(r.Invoices), amount(r.Net), amount(r.Tax))
+	}
+	table.SetFooter("Total", "", strconv.Itoa(report.Total.Invoices), amount(report.Total.Net), amount(report.Total.Tax))
+
+	if format == config.ReportFormatTable {
+		fmt.Println("vat report", report.Period, "from", report.From.Format(config.QueryDateFormat), "to", report.To.Format(config.QueryDateFormat))
+	}
+	renderReport(cmd, table, report)
+}
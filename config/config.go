@@ -28,16 +28,49 @@ func GetTemplatesHome() string {
 	return path.Join(GetConfigHome(), "templates")
 }
 
+// GetProfilesHome returns the sender profiles home
+// default is CONFIG_HOME/profiles/
+func GetProfilesHome() string {
+	return path.Join(GetConfigHome(), "profiles")
+}
+
+// GetProfilePath returns the path of a sender profile within the profiles home,
+// returns also a bool if the profile exists (true) or not (false)
+func GetProfilePath(name string) (string, bool) {
+	return getPath(GetProfilesHome(), name, ExtToml)
+}
+
 // GetSearchIndexFilePath returns the bleve index folder
-// default is CONFIG_HOME/index.bleve/
+// default is CONFIG_HOME/index.bleve/, CONFIG_HOME/index.PROFILE.bleve/ for the sender profiles
 func GetSearchIndexFilePath() (string, bool) {
 	ifp := path.Join(GetConfigHome(), "index.bleve")
+	if Profile != "" {
+		ifp = path.Join(GetConfigHome(), fmt.Sprintf("index.%s.bleve", Profile))
+	}
 	if _, err := os.Stat(ifp); os.IsNotExist(err) {
 		return ifp, false
 	}
 	return ifp, true
 }
 
+// GetExchangeRatesPath returns the path of the exchange rates store
+// default is CONFIG_HOME/exchange_rates.json
+func GetExchangeRatesPath() (string, bool) {
+	rp := path.Join(GetConfigHome(), ExchangeRatesFileName)
+	return rp, FileExists(rp)
+}
+
+// GetIdentityFilePath returns the path of the file with the secret keys used
+// to decrypt the descriptors encrypted for recipients
+// default is CONFIG_HOME/identity.txt
+func GetIdentityFilePath() (string, bool) {
+	ip := Govoice.IdentityFile
+	if len(strings.TrimSpace(ip)) == 0 {
+		ip = path.Join(GetConfigHome(), IdentityFileName)
+	}
+	return ip, FileExists(ip)
+}
+
 // GetTemplatePath returns the path of a template within the
 // templates home folder (@see GetTemplatesHome)
 func GetTemplatePath(name string) (templatePath string, templateExists bool) {
@@ -61,6 +94,30 @@ type MainConfig struct {
 	MasterDescriptor  string `toml:"masterDescriptor"`
 	DateInputFormat   string `toml:"dateInputFormat"`
 	DefaultInvoiceNet int    `toml:"defaultInvoiceNet"`
+	// key derivation (scrypt) parameters used to encrypt the descriptors,
+	// the cost is the log2 of the scrypt N parameter
+	KdfCost            int `toml:"kdfCost"`
+	KdfBlockSize       int `toml:"kdfBlockSize"`
+	KdfParallelization int `toml:"kdfParallelization"`
+	// where to read the password from (terminal, env, file, command, stdin)
+	PasswordSource  string `toml:"passwordSource"`
+	PasswordFile    string `toml:"passwordFile"`
+	PasswordCommand string `toml:"passwordCommand"`
+	// public keys of the recipients, when set the descriptors are encrypted
+	// for the recipients instead of with the password
+	Recipients   []string `toml:"recipients"`
+	IdentityFile string   `toml:"identityFile"`
+	// invoice numbering, the pattern can contain {YYYY}, {YY}, {MM}, {SERIES} and {SEQ:n},
+	// the series map the series names to the prefixes of the numbers
+	NumberPattern     string            `toml:"numberPattern"`
+	NumberYearlyReset bool              `toml:"numberYearlyReset"`
+	NumberSeries      map[string]string `toml:"numberSeries"`
+	// rounding of the amounts: mode is half_up or half_even,
+	// scope is line (round the cost of each item) or total
+	RoundingMode  string `toml:"roundingMode"`
+	RoundingScope string `toml:"roundingScope"`
+	// currency of the search totals and of the reports, ISO 4217 code
+	BaseCurrency string `toml:"baseCurrency"`
 }
 
 //GetMasterPath returns the path to the master invoice
@@ -74,6 +131,25 @@ func GetInvoiceJsonPath(name string) (string, bool) {
 	return getPath(Govoice.Workspace, name, ExtJsonEncripted)
 }
 
+// GetRekeyJournalPath returns the folder used to journal a password change
+// default is WORKSPACE/.rekey/, returns also a bool if the journal exists (true) or not (false)
+func GetRekeyJournalPath() (string, bool) {
+	jp := path.Join(Govoice.Workspace, ".rekey")
+	return jp, FileExists(path.Join(jp, RekeyJournalFileName))
+}
+
+// GetPaymentLedgerPath returns the path of the encrypted payment ledger
+// default is WORKSPACE/_payments.ledger, returns also a bool if the ledger exists (true) or not (false)
+func GetPaymentLedgerPath() (string, bool) {
+	return getPath(Govoice.Workspace, PaymentLedgerFileName, ExtLedger)
+}
+
+// GetCustomerRegistryPath returns the path of the encrypted customer registry
+// default is WORKSPACE/_customers.registry, returns also a bool if the registry exists (true) or not (false)
+func GetCustomerRegistryPath() (string, bool) {
+	return getPath(Govoice.Workspace, CustomerRegistryFileName, ExtRegistry)
+}
+
 // GetInvoicePdfPath get the pdf path
 func GetInvoicePdfPath(name string) (string, bool) {
 	return getPath(Govoice.Workspace, name, ExtPdf)
@@ -104,3 +180,7 @@ var DebugEnabled = false
 
 // TemplateName loaded at startup via -t paramter
 var TemplateName = DefaultTemplateName
+
+// Profile is the sender profile in use, selected via --profile parameter
+// or by the master descriptor, empty for the default sender
+var Profile string
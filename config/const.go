@@ -8,6 +8,8 @@ const (
 	ExtTemplate      = "tpl.toml"
 	ExtJsonEncripted = "json.cfb"
 	ExtCfb           = ".cfb"
+	ExtLedger        = "ledger"
+	ExtRegistry      = "registry"
 )
 
 // templates
@@ -20,18 +22,125 @@ const (
 	PreviewFileName = "PREVIEW"
 )
 
+// password sources
+const (
+	PasswordSourceTerminal = "terminal"
+	PasswordSourceEnv      = "env"
+	PasswordSourceFile     = "file"
+	PasswordSourceCommand  = "command"
+	PasswordSourceStdin    = "stdin"
+
+	PasswordEnvVar = "GOVOICE_PASSWORD"
+	// NewPasswordEnvVar is the new password for rekey
+	NewPasswordEnvVar = "GOVOICE_NEW_PASSWORD"
+
+	IdentityFileName = "identity.txt"
+)
+
+// rekey
+const (
+	RekeyJournalFileName = "journal.json"
+)
+
+// numbering
+const (
+	DefaultSeries    = "default"
+	CreditNoteSeries = "credit"
+	// prefix of the credit series when it is not in the configuration
+	DefaultCreditNotePrefix = "CN-"
+)
+
+// payments
+const (
+	PaymentLedgerFileName = "_payments"
+	// file name of the encrypted customer registry
+	CustomerRegistryFileName = "_customers"
+
+	StatusOpen          = "open"
+	StatusPartiallyPaid = "partially_paid"
+	StatusPaid          = "paid"
+	StatusOverdue       = "overdue"
+	StatusCredited      = "credited"
+)
+
+// reports
+const (
+	ReportFormatTable = "table"
+	ReportFormatCSV   = "csv"
+	ReportFormatJSON  = "json"
+	ReportFormatChart = "chart"
+
+	PeriodMonth   = "month"
+	PeriodQuarter = "quarter"
+	PeriodYear    = "year"
+	PeriodNone    = "none"
+
+	VatDomestic = "domestic"
+	VatIntraEU  = "intra_eu"
+	VatExport   = "export"
+)
+
+// tax treatments
+const (
+	TaxStandard       = "standard"
+	TaxReverseCharge  = "reverse_charge"
+	TaxIntraCommunity = "intra_community"
+	TaxExport         = "export"
+	TaxExempt         = "exempt"
+)
+
+// additional taxes
+const (
+	AdditionalTaxBaseNet   = "net"
+	AdditionalTaxBaseGross = "gross"
+)
+
+// currencies
+const (
+	DefaultCurrency       = "EUR"
+	ExchangeRatesFileName = "exchange_rates.json"
+)
+
+// rounding
+const (
+	RoundingHalfUp     = "half_up"
+	RoundingHalfEven   = "half_even"
+	RoundingScopeLine  = "line"
+	RoundingScopeTotal = "total"
+)
+
 // searcing
 const (
 	FieldNumber   = "Number"
 	FieldCustomer = "Customer"
 	FieldAmount   = "Amount"
+	FieldTax      = "Tax"
+	FieldTaxes    = "Taxes"
+	FieldTaxRate  = "Taxes.Rate"
 	FieldDate     = "Date"
 	FieldText     = "Text"
 
+	FieldCreditNoteOf = "CreditNoteOf"
+	FieldCreditedBy   = "CreditedBy"
+
+	FieldStatus      = "Status"
+	FieldDue         = "Due"
+	FieldTotal       = "Total"
+	FieldPaid        = "Paid"
+	FieldOutstanding = "Outstanding"
+
+	FieldCurrency        = "Currency"
+	FieldBaseAmount      = "BaseAmount"
+	FieldBaseTax         = "BaseTax"
+	FieldBaseTotal       = "BaseTotal"
+	FieldBaseOutstanding = "BaseOutstanding"
+
 	QueryDateFormat      = "2006-01-02"
 	QueryDefaultDateFrom = "1970-01-01"
 	QueryDefaultAmountGE = float64(0)
 	QueryDefaultAmountLE = float64(1000000000000)
+	QueryDefaultTaxRate  = float64(-1)
 	QueryDefaultCustomer = "none"
 	QueryDefaultText     = ""
+	QueryDefaultStatus   = ""
 )
@@ -0,0 +1,79 @@
+package invoice
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+// AdditionalTax is a tax added to or withheld from the amount due after the vat,
+// for example a social security contribution or a withholding tax (ritenuta, IRPF)
+type AdditionalTax struct {
+	// Name identifies the tax, the label of its row is the label
+	// of the name in the template, or the name itself
+	Name string  `json:"name"`
+	Rate float64 `json:"rate"`
+	// Withheld taxes are subtracted from the amount due, the others are added
+	Withheld bool `json:"withheld,omitempty"`
+	// Base is net (the subtotal, default) or gross (the subtotal with the vat)
+	Base string `json:"base,omitempty"`
+}
+
+// AdditionalTaxLine is the amount of an additional tax, negative if withheld
+type AdditionalTaxLine struct {
+	Name   string
+	Rate   float64
+	Base   Money
+	Amount Money
+}
+
+// GetAdditionalTaxes calculate the additional taxes of the invoice, in the order of the settings
+func (i *Invoice) GetAdditionalTaxes() (lines []AdditionalTaxLine) {
+	subtotal, _, taxes := i.computeTaxes()
+	return i.additionalTaxes(subtotal, taxes)
+}
+
+// additionalTaxes computes the additional taxes on the subtotal and the vat of the invoice
+func (i *Invoice) additionalTaxes(subtotal Money, taxes []TaxLine) (lines []AdditionalTaxLine) {
+	gross := subtotal
+	for _, t := range taxes {
+		gross = gross.Add(t.Amount)
+	}
+	r := newRounding(&i.Settings)
+	for _, at := range i.Settings.AdditionalTaxes {
+		base := subtotal
+		if at.Base == config.AdditionalTaxBaseGross {
+			base = gross
+		}
+		amount := new(big.Rat).Mul(base.Rat(), decimalRat(at.Rate))
+		amount.Quo(amount, big.NewRat(100, 1))
+		if at.Withheld {
+			amount.Neg(amount)
+		}
+		lines = append(lines, AdditionalTaxLine{
+			Name:   at.Name,
+			Rate:   at.Rate,
+			Base:   base,
+			Amount: r.round(amount, base.Currency),
+		})
+	}
+	return
+}
+
+// ValidateAdditionalTaxes checks the names, the rates and the bases of the additional taxes
+func (i *Invoice) ValidateAdditionalTaxes() error {
+	for _, at := range i.Settings.AdditionalTaxes {
+		if strings.TrimSpace(at.Name) == "" {
+			return fmt.Errorf("missing name of an additional tax")
+		}
+		if at.Rate < 0 {
+			return fmt.Errorf("invalid rate %v of the additional tax %s", at.Rate, at.Name)
+		}
+		if at.Base != "" && at.Base != config.AdditionalTaxBaseNet && at.Base != config.AdditionalTaxBaseGross {
+			return fmt.Errorf("invalid base '%s' of the additional tax %s, use net or gross", at.Base, at.Name)
+		}
+	}
+	return nil
+}
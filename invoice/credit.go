@@ -0,0 +1,124 @@
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+// Errors
+var (
+	ErrInvoiceAlreadyCredited   = errors.New("invoice already credited")
+	ErrCreditNoteOfCreditNote   = errors.New("a credit note cannot be credited")
+	ErrCreditNoteNumberRequired = errors.New("invoice numbering not configured, set numberPattern in the configuration or give the credit note number with --number")
+)
+
+// newCreditNote creates the credit note of an invoice: same parties and items with negative
+// quantities, the credit note refers to the number of the original invoice
+func newCreditNote(original *Invoice, number string, date time.Time) (c Invoice) {
+	c = *original
+	c.Invoice = InvoiceData{
+		Number:       number,
+		Series:       config.CreditNoteSeries,
+		CreditNoteOf: original.Invoice.Number,
+	}
+	format := c.Settings.DateInputFormat
+	if format == "" {
+		format = config.Govoice.DateInputFormat
+		c.Settings.DateInputFormat = format
+	}
+	c.Invoice.Date = date.Format(dateFormatToLayout(format))
+	c.Invoice.Due = c.Invoice.Date
+
+	items := []Item{}
+	if original.Items != nil {
+		for _, it := range *original.Items {
+			// use the quantity as billed, the rounding does not work on negative quantities
+			if original.Settings.RoundQuantity {
+				it.Quantity = math.Ceil(it.Quantity*2) / 2
+			}
+			it.Quantity = -it.Quantity
+			items = append(items, it)
+		}
+	}
+	c.Items = &items
+	c.Settings.RoundQuantity = false
+	c.Notes = append([]string{fmt.Sprint("credit note of invoice ", original.Invoice.Number)}, original.Notes...)
+	return
+}
+
+// CreditInvoice creates, renders and archives the credit note of an invoice, the original
+// invoice is not modified but it is recorded as credited in the payment ledger and in the search index.
+// If the credit note number is empty the next number of the credit series is used.
+// Returns the number of the credit note
+func CreditInvoice(invoiceNumber, creditNoteNumber, password, templatePath string) (number string, err error) {
+	descriptorPath, exists := config.GetInvoiceJsonPath(invoiceNumber)
+	if !exists {
+		err = fmt.Errorf("invoice %s not found in %s", invoiceNumber, descriptorPath)
+		return
+	}
+	original, err := readInvoiceDescriptorEncrypted(descriptorPath, password)
+	if err != nil {
+		return
+	}
+	if original.Invoice.CreditNoteOf != "" {
+		err = ErrCreditNoteOfCreditNote
+		return
+	}
+	ledger, err := ReadPaymentLedger(password)
+	if err != nil {
+		return
+	}
+	if cn := ledger.CreditedBy(invoiceNumber); cn != "" {
+		err = fmt.Errorf("%v by %s", ErrInvoiceAlreadyCredited, cn)
+		return
+	}
+
+	number = strings.TrimSpace(creditNoteNumber)
+	if number == "" {
+		if number, err = NextInvoiceNumber(config.CreditNoteSeries, time.Now()); err == ErrNumberingNotConfigured {
+			err = ErrCreditNoteNumberRequired
+		}
+		if err != nil {
+			return
+		}
+	}
+	creditPath, exists := config.GetInvoiceJsonPath(number)
+	if exists {
+		err = InvoiceDescriptorExists
+		return
+	}
+	template, err := readInvoiceTemplate(templatePath)
+	if err != nil {
+		return
+	}
+
+	credit := newCreditNote(&original, number, time.Now())
+	pdfPath, _ := config.GetInvoicePdfPath(number)
+	RenderPDF(&credit, pdfPath, &template)
+	if err = writeInvoiceDescriptorEncrypted(&credit, creditPath, password); err != nil {
+		return
+	}
+	ledger.Credits = append(ledger.Credits, Credit{Invoice: invoiceNumber, CreditNote: number, Date: time.Now()})
+	if err = writePaymentLedger(&ledger, password); err != nil {
+		return
+	}
+
+	// index the credit note and mark the original as credited
+	creditEntry, err := invoiceEntry(&credit)
+	if err != nil {
+		return
+	}
+	originalEntry, err := invoiceEntry(&original)
+	if err != nil {
+		return
+	}
+	originalEntry.CreditedBy = number
+	originalEntry.setPaid(ledger.Paid(invoiceNumber))
+	err = updateSearchIndex(creditEntry, originalEntry)
+	return
+}
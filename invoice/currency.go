@@ -0,0 +1,282 @@
+package invoice
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+// the days without rates before the date of a conversion (week ends and holidays)
+const maxRateAge = 7
+
+// currencyCode matches the ISO 4217 currency codes
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// ExchangeRates are the reference rates of the currencies against the euro,
+// as published by the ECB: units of the currency for one euro, by day (2006-01-02)
+type ExchangeRates struct {
+	Rates map[string]map[string]float64 `json:"rates"`
+}
+
+// conversion converts the amounts of a currency to another one
+type conversion struct {
+	factor *big.Rat
+	to     string
+}
+
+// convert converts an amount, rounded half up to the minor units
+func (c conversion) convert(m Money) Money {
+	return rounding{Mode: config.RoundingHalfUp}.round(new(big.Rat).Mul(m.Rat(), c.factor), c.to)
+}
+
+// Float64 returns the factor of the conversion, for indexing
+func (c conversion) Float64() float64 {
+	f, _ := c.factor.Float64()
+	return f
+}
+
+// BaseCurrency returns the currency of the reports, EUR if not configured
+func BaseCurrency() string {
+	if c := strings.ToUpper(strings.TrimSpace(config.Govoice.BaseCurrency)); c != "" {
+		return c
+	}
+	return config.DefaultCurrency
+}
+
+// currencyOf returns the currency code of an amount, empty is the base currency
+func currencyOf(code string) string {
+	if c := strings.ToUpper(strings.TrimSpace(code)); c != "" {
+		return c
+	}
+	return BaseCurrency()
+}
+
+// ReadExchangeRates reads the exchange rates store, empty if no rates have been imported
+func ReadExchangeRates() (r ExchangeRates, err error) {
+	r.Rates = make(map[string]map[string]float64)
+	ratesPath, exists := config.GetExchangeRatesPath()
+	if !exists {
+		return
+	}
+	rawData, err := ioutil.ReadFile(ratesPath)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(rawData, &r)
+	return
+}
+
+// write writes the exchange rates store
+func (r *ExchangeRates) write() error {
+	content, err := json.MarshalIndent(*r, "", "  ")
+	if err != nil {
+		return err
+	}
+	ratesPath, _ := config.GetExchangeRatesPath()
+	return writeFileAtomic(ratesPath, content)
+}
+
+// Latest returns the day of the most recent rates and the rates, empty if there are none
+func (r *ExchangeRates) Latest() (day string, rates map[string]float64) {
+	for d := range r.Rates {
+		if d > day {
+			day = d
+		}
+	}
+	return day, r.Rates[day]
+}
+
+// Rate returns the rate of a currency (units for one euro) at a date, that is the rate of the
+// date or of the previous days with rates
+func (r *ExchangeRates) Rate(currency string, date time.Time) (rate *big.Rat, err error) {
+	if currency == config.DefaultCurrency {
+		return big.NewRat(1, 1), nil
+	}
+	for d := 0; d <= maxRateAge; d++ {
+		if v, exists := r.Rates[date.AddDate(0, 0, -d).Format(config.QueryDateFormat)][currency]; exists && v > 0 {
+			return decimalRat(v), nil
+		}
+	}
+	err = fmt.Errorf("no exchange rate for %s at %s, import the ECB rates with govoice rates import", currency, date.Format(config.QueryDateFormat))
+	return
+}
+
+// conversion returns the conversion between two currencies at a date
+func (r *ExchangeRates) conversion(from, to string, date time.Time) (c conversion, err error) {
+	c = conversion{factor: big.NewRat(1, 1), to: to}
+	if from == to {
+		return
+	}
+	rf, err := r.Rate(from, date)
+	if err != nil {
+		return
+	}
+	rt, err := r.Rate(to, date)
+	if err != nil {
+		return
+	}
+	c.factor.Quo(rt, rf)
+	return
+}
+
+// invoiceConversion returns the conversion of the amounts of an invoice to the base currency,
+// at the date of the invoice
+func (r *ExchangeRates) invoiceConversion(i *Invoice) (conversion, error) {
+	return r.conversion(currencyOf(i.Settings.Currency), BaseCurrency(), invoiceDate(i))
+}
+
+// ImportExchangeRates adds the rates of an ECB eurofxref file (daily or historical, XML or CSV)
+// to the exchange rates store. Returns the number of days imported
+func ImportExchangeRates(path string) (days int, err error) {
+	rawData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var imported map[string]map[string]float64
+	if bytes.HasPrefix(bytes.TrimSpace(rawData), []byte("<")) {
+		imported, err = parseECBXml(rawData)
+	} else {
+		imported, err = parseECBCsv(rawData)
+	}
+	if err != nil {
+		return
+	}
+	if len(imported) == 0 {
+		err = fmt.Errorf("no exchange rates found in %s", path)
+		return
+	}
+	r, err := ReadExchangeRates()
+	if err != nil {
+		return
+	}
+	for d, rates := range imported {
+		r.Rates[d] = rates
+	}
+	err = r.write()
+	days = len(imported)
+	return
+}
+
+// parseECBXml reads the rates of an eurofxref XML file
+func parseECBXml(data []byte) (rates map[string]map[string]float64, err error) {
+	var envelope struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string  `xml:"currency,attr"`
+				Rate     float64 `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube>Cube"`
+	}
+	if err = xml.Unmarshal(data, &envelope); err != nil {
+		err = fmt.Errorf("invalid ECB xml file: %v", err)
+		return
+	}
+	rates = make(map[string]map[string]float64)
+	for _, d := range envelope.Days {
+		day, perr := time.Parse(config.QueryDateFormat, d.Time)
+		if perr != nil {
+			err = fmt.Errorf("invalid date %s in the ECB xml file", d.Time)
+			return
+		}
+		key := day.Format(config.QueryDateFormat)
+		rates[key] = make(map[string]float64)
+		for _, r := range d.Rates {
+			rates[key][strings.ToUpper(r.Currency)] = r.Rate
+		}
+	}
+	return
+}
+
+// parseECBCsv reads the rates of an eurofxref CSV file: a header with the currencies
+// and a row for every day, the missing rates are N/A
+func parseECBCsv(data []byte) (rates map[string]map[string]float64, err error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		err = fmt.Errorf("invalid ECB csv file: %v", err)
+		return
+	}
+	if len(records) < 2 || !strings.EqualFold(strings.TrimSpace(records[0][0]), "date") {
+		err = fmt.Errorf("invalid ECB csv file: the header must start with Date")
+		return
+	}
+	header := records[0]
+	rates = make(map[string]map[string]float64)
+	for _, record := range records[1:] {
+		day, perr := parseECBDate(record[0])
+		if perr != nil {
+			err = perr
+			return
+		}
+		key := day.Format(config.QueryDateFormat)
+		rates[key] = make(map[string]float64)
+		for c := 1; c < len(record) && c < len(header); c++ {
+			currency := strings.ToUpper(strings.TrimSpace(header[c]))
+			if v, perr := strconv.ParseFloat(strings.TrimSpace(record[c]), 64); perr == nil && currency != "" {
+				rates[key][currency] = v
+			}
+		}
+	}
+	return
+}
+
+// parseECBDate parses the dates of the ECB csv files, 2006-01-02 or 2 January 2006
+func parseECBDate(value string) (t time.Time, err error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{config.QueryDateFormat, "2 January 2006"} {
+		if t, err = time.Parse(layout, value); err == nil {
+			return
+		}
+	}
+	err = fmt.Errorf("invalid date %s in the ECB csv file", value)
+	return
+}
+
+// ValidateCurrency checks that the currency of the invoice is an ISO 4217 code
+// and that the fixed discounts are in the minor units of the currency
+func (i *Invoice) ValidateCurrency() error {
+	c := strings.TrimSpace(i.Settings.Currency)
+	if c != "" && !currencyCode.MatchString(strings.ToUpper(c)) {
+		return fmt.Errorf("invalid currency '%s', use an ISO 4217 code (ex. EUR, USD)", c)
+	}
+	discounts := []*Discount{i.Discount}
+	if i.Items != nil {
+		for n := range *i.Items {
+			discounts = append(discounts, (*i.Items)[n].Discount)
+		}
+	}
+	for _, d := range discounts {
+		if !d.IsEmpty() && !inMinorUnits(d.Amount, c) {
+			return fmt.Errorf("invalid discount %v, %s amounts have %d decimals", d.Amount, currencyOf(c), CurrencyDecimals(c))
+		}
+	}
+	return nil
+}
+
+// inMinorUnits tells if an amount in major units is a whole number of minor units of the currency
+func inMinorUnits(f float64, currency string) bool {
+	return new(big.Rat).Mul(decimalRat(f), big.NewRat(minorUnits(currency), 1)).IsInt()
+}
+
+// Currencies returns the sorted currencies of a set of rates
+func Currencies(rates map[string]float64) (currencies []string) {
+	for c := range rates {
+		currencies = append(currencies, c)
+	}
+	sort.Strings(currencies)
+	return
+}
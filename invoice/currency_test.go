@@ -0,0 +1,161 @@
+package invoice
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+const ecbXml = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2026-03-06">
+			<Cube currency="USD" rate="1.0850"/>
+			<Cube currency="GBP" rate="0.8400"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+const ecbCsv = `Date, USD, JPY, GBP, CYP,
+2026-03-03, 1.0800, 160.50, 0.8500, N/A,
+2026-03-02, 1.0750, 160.10, 0.8450, N/A,
+`
+
+func TestImportExchangeRates(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	if _, _, err := Setup(tmpWorkspace); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	xmlPath, csvPath := path.Join(tmpHome, "eurofxref.xml"), path.Join(tmpHome, "eurofxref.csv")
+	ioutil.WriteFile(xmlPath, []byte(ecbXml), 0600)
+	ioutil.WriteFile(csvPath, []byte(ecbCsv), 0600)
+
+	if days, err := ImportExchangeRates(xmlPath); err != nil || days != 1 {
+		t.Error("expected", 1, "found", days, err)
+	}
+	if days, err := ImportExchangeRates(csvPath); err != nil || days != 2 {
+		t.Error("expected", 2, "found", days, err)
+	}
+	if _, err := ImportExchangeRates(tmpWorkspace); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+
+	r, err := ReadExchangeRates()
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if day, latest := r.Latest(); day != "2026-03-06" || len(latest) != 2 {
+		t.Error("expected", "2026-03-06", 2, "found", day, len(latest))
+	}
+	if _, exists := r.Rates["2026-03-02"]["CYP"]; exists {
+		t.Error("unexpected rate for CYP")
+	}
+
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		currency string
+		date     time.Time
+		expected string
+	}{
+		{"USD", day(2), "1.0750"},
+		{"USD", day(3), "1.0800"},
+		// no rates on the 4th and the 5th
+		{"USD", day(5), "1.0800"},
+		{"GBP", day(8), "0.8400"},
+		{"EUR", day(1), "1.0000"},
+	}
+	for _, tt := range tests {
+		rate, err := r.Rate(tt.currency, tt.date)
+		if err != nil || rate.FloatString(4) != tt.expected {
+			t.Error("expected", tt.expected, "found", rate, err)
+		}
+	}
+	// too old or unknown
+	if _, err = r.Rate("USD", day(20)); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+	if _, err = r.Rate("JPY", day(6)); err != nil {
+		t.Error("unexpected", err, "as error")
+	}
+	if _, err = r.Rate("CHF", day(6)); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+
+	// 108.00 USD are 100.00 EUR on the 3rd, and 85.00 GBP
+	c, err := r.conversion("USD", "EUR", day(3))
+	if found := c.convert(Money{Amount: 10800, Currency: "USD"}); err != nil || found.String() != "100.00" || found.Currency != "EUR" {
+		t.Error("expected", "100.00 EUR", "found", found, found.Currency, err)
+	}
+	c, err = r.conversion("USD", "GBP", day(3))
+	if found := c.convert(Money{Amount: 10800}); err != nil || found.String() != "85.00" {
+		t.Error("expected", "85.00", "found", found, err)
+	}
+	// the yen has no minor units
+	c, err = r.conversion("USD", "JPY", day(3))
+	if found := c.convert(Money{Amount: 10801, Currency: "USD"}); err != nil || found.Amount != 16051 || found.String() != "16051" {
+		t.Error("expected", "16051", "found", found, err)
+	}
+}
+
+func TestCurrencyInvoiceEntry(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	if _, _, err := Setup(tmpWorkspace); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	rates := ExchangeRates{Rates: map[string]map[string]float64{"2026-03-02": {"USD": 1.25}}}
+	items := []Item{{Quantity: 1, Price: 100}}
+	i := Invoice{
+		Invoice:  InvoiceData{Number: "1", Date: "02.03.2026"},
+		Settings: InvoiceSettings{VatRate: 20, Currency: "usd"},
+		Items:    &items,
+	}
+	ie, err := newInvoiceEntry(&i, invoiceDate(&i), &rates)
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if ie.Currency != "USD" || ie.Amount != 100 || ie.BaseAmount != 80 || ie.BaseTax != 16 || ie.BaseTotal != 96 {
+		t.Error("expected", "USD", 100, 80, 16, 96, "found", ie.Currency, ie.Amount, ie.BaseAmount, ie.BaseTax, ie.BaseTotal)
+	}
+	ie.setPaid(Money{Amount: 6000})
+	if ie.Outstanding != 60 || ie.BaseOutstanding != 48 {
+		t.Error("expected", 60, 48, "found", ie.Outstanding, ie.BaseOutstanding)
+	}
+
+	// the invoices in the base currency need no rates
+	i.Settings.Currency = ""
+	if ie, err = newInvoiceEntry(&i, invoiceDate(&i), &ExchangeRates{}); err != nil || ie.Currency != config.DefaultCurrency || ie.BaseTotal != 120 {
+		t.Error("expected", config.DefaultCurrency, 120, "found", ie.Currency, ie.BaseTotal, err)
+	}
+	// no rates for the currency
+	i.Settings.Currency = "CHF"
+	if _, err = newInvoiceEntry(&i, invoiceDate(&i), &rates); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+
+	for c, valid := range map[string]bool{"": true, "USD": true, "gbp": true, "EURO": false, "€": false, "U1D": false} {
+		i.Settings.Currency = c
+		if err = i.ValidateCurrency(); (err == nil) != valid {
+			t.Error(c, "expected valid", valid, "found", err)
+		}
+	}
+	// the fixed discounts are in the minor units of the currency
+	for c, valid := range map[string]bool{"USD": true, "JPY": false, "KWD": true} {
+		i.Settings.Currency = c
+		i.Discount = &Discount{Amount: 0.5}
+		if err = i.ValidateCurrency(); (err == nil) != valid {
+			t.Error(c, "expected valid", valid, "found", err)
+		}
+	}
+	items[0].Discount = &Discount{Amount: 0.0005}
+	i.Settings.Currency, i.Discount = "KWD", nil
+	if err = i.ValidateCurrency(); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+}
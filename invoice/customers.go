@@ -0,0 +1,276 @@
+package invoice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+// Errors
+var (
+	ErrCustomerNotFound     = errors.New("customer not found, list the customers with govoice customer list")
+	ErrCustomerExists       = errors.New("a customer with the same id already exists")
+	ErrCustomerNameRequired = errors.New("the customer name is required")
+)
+
+// customerId matches the ids of the customers: lowercase letters, digits, - and _
+var customerId = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Customer is a customer of the address book, the id is assigned when the customer
+// is added and never changes, so the master descriptor can reference it
+type Customer struct {
+	Id        string    `json:"id"`
+	Recipient Recipient `json:"recipient"`
+	// defaults of the invoices of the customer, they are used for the settings
+	// that the master descriptor leaves empty
+	HourlyRate      float64 `json:"hourly_rate,omitempty"`
+	Currency        string  `json:"currency,omitempty"`
+	TaxTreatment    string  `json:"tax_treatment,omitempty"`
+	ExemptionReason string  `json:"exemption_reason,omitempty"`
+	// PaymentTerms are the days from the invoice date to the due date
+	PaymentTerms int    `json:"payment_terms,omitempty"`
+	Language     string `json:"lang,omitempty"`
+	Template     string `json:"template,omitempty"`
+}
+
+// CustomerRegistry is the address book of the customers, stored encrypted in the workspace
+type CustomerRegistry struct {
+	Customers []Customer `json:"customers"`
+}
+
+// Get returns the customer with an id
+func (r *CustomerRegistry) Get(id string) (c *Customer, err error) {
+	for n := range r.Customers {
+		if r.Customers[n].Id == id {
+			return &r.Customers[n], nil
+		}
+	}
+	err = ErrCustomerNotFound
+	return
+}
+
+// Add adds a customer to the registry, if the id is empty it is derived from the name
+func (r *CustomerRegistry) Add(c Customer) (id string, err error) {
+	if c.Id == "" {
+		c.Id = r.newCustomerId(c.Recipient.Name)
+	}
+	if err = c.Validate(); err != nil {
+		return
+	}
+	if _, gerr := r.Get(c.Id); gerr == nil {
+		err = ErrCustomerExists
+		return
+	}
+	r.Customers = append(r.Customers, c)
+	sort.Slice(r.Customers, func(i, j int) bool { return r.Customers[i].Id < r.Customers[j].Id })
+	id = c.Id
+	return
+}
+
+// Remove removes the customer with an id from the registry
+func (r *CustomerRegistry) Remove(id string) error {
+	for n := range r.Customers {
+		if r.Customers[n].Id == id {
+			r.Customers = append(r.Customers[:n], r.Customers[n+1:]...)
+			return nil
+		}
+	}
+	return ErrCustomerNotFound
+}
+
+// newCustomerId returns an unused id from the name of a customer (ex. ACME GmbH -> acme-gmbh)
+func (r *CustomerRegistry) newCustomerId(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "-"):
+			b.WriteRune('-')
+		}
+	}
+	base := strings.TrimSuffix(b.String(), "-")
+	if base == "" {
+		base = "customer"
+	}
+	id := base
+	for n := 2; ; n++ {
+		if _, err := r.Get(id); err != nil {
+			return id
+		}
+		id = fmt.Sprint(base, "-", n)
+	}
+}
+
+// Validate checks the id, the name and the defaults of the customer
+func (c *Customer) Validate() error {
+	if !customerId.MatchString(c.Id) {
+		return fmt.Errorf("invalid customer id '%s', use lowercase letters, digits, - and _", c.Id)
+	}
+	if strings.TrimSpace(c.Recipient.Name) == "" {
+		return ErrCustomerNameRequired
+	}
+	if c.HourlyRate < 0 || c.PaymentTerms < 0 {
+		return fmt.Errorf("the hourly rate and the payment terms of the customer cannot be negative")
+	}
+	i := Invoice{Settings: InvoiceSettings{Currency: c.Currency}}
+	if err := i.ValidateCurrency(); err != nil {
+		return err
+	}
+	if c.TaxTreatment == "" {
+		return nil
+	}
+	if c.TaxTreatment == config.TaxExempt && strings.TrimSpace(c.ExemptionReason) == "" {
+		return ErrExemptionReasonRequired
+	}
+	for _, t := range TaxTreatments {
+		if t == c.TaxTreatment {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown tax treatment '%s', use one of %s", c.TaxTreatment, strings.Join(TaxTreatments, ", "))
+}
+
+// apply sets the recipient of the customer in an invoice and its defaults
+// in the settings that the invoice leaves empty
+func (c *Customer) apply(i *Invoice) {
+	i.Customer = c.Id
+	i.To = c.Recipient
+	if c.HourlyRate > 0 && i.Settings.ItemsPrice == 0 {
+		i.Settings.ItemsPrice = c.HourlyRate
+	}
+	if c.Currency != "" && i.Settings.Currency == "" {
+		i.Settings.Currency = strings.ToUpper(c.Currency)
+	}
+	if c.TaxTreatment != "" && i.Settings.TaxTreatment == "" {
+		i.Settings.TaxTreatment = c.TaxTreatment
+		i.Settings.ExemptionReason = c.ExemptionReason
+	}
+	if c.Language != "" && i.Settings.Language == "" {
+		i.Settings.Language = c.Language
+	}
+	if c.PaymentTerms > 0 && i.Invoice.Due == "" {
+		format := i.Settings.DateInputFormat
+		if format == "" {
+			format = config.Govoice.DateInputFormat
+		}
+		i.Invoice.Due = invoiceDate(i).AddDate(0, 0, c.PaymentTerms).Format(dateFormatToLayout(format))
+	}
+}
+
+// ReadCustomerRegistry decrypts the customer registry of the workspace,
+// the registry is empty if no customer has been added yet
+func ReadCustomerRegistry(password string) (r CustomerRegistry, err error) {
+	registryPath, exists := config.GetCustomerRegistryPath()
+	if !exists {
+		return
+	}
+	rawData, err := ioutil.ReadFile(registryPath)
+	if err != nil {
+		return
+	}
+	if rawData, err = decryptDescriptor(password, rawData); err != nil {
+		return
+	}
+	err = json.Unmarshal(rawData, &r)
+	return
+}
+
+// WriteCustomerRegistry encrypts and writes the customer registry in the workspace,
+// a new registry is written only if the password decrypts the other files of the workspace
+func WriteCustomerRegistry(r *CustomerRegistry, password string) error {
+	registryPath, exists := config.GetCustomerRegistryPath()
+	if !exists {
+		if err := checkWorkspacePassword(password); err != nil {
+			return err
+		}
+	}
+	content, err := json.MarshalIndent(*r, "", "  ")
+	if err != nil {
+		return err
+	}
+	encContent, err := encryptDescriptor(password, content)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(registryPath, encContent)
+}
+
+// checkWorkspacePassword decrypts the first file of the workspace encrypted with a password
+// (a descriptor or the payment ledger), so a mistyped password is not used for a new file
+func checkWorkspacePassword(password string) error {
+	names, err := encryptedFiles()
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		data, err := ioutil.ReadFile(path.Join(config.Govoice.Workspace, n))
+		if err != nil {
+			return err
+		}
+		if envelopeVersion(data) != envelopeVersion2 {
+			_, err = decryptDescriptor(password, data)
+			return err
+		}
+	}
+	return nil
+}
+
+// MasterCustomer returns the id of the customer referenced by the master descriptor, empty if none
+func MasterCustomer() (id string, err error) {
+	descriptorPath, exists := config.GetMasterPath()
+	if !exists {
+		return
+	}
+	i, err := readInvoiceDescriptor(descriptorPath)
+	id = strings.TrimSpace(i.Customer)
+	return
+}
+
+// resolveCustomer replaces the recipient and the settings of an invoice that references
+// a customer with the ones of the registry, returns the customer (nil if none)
+func resolveCustomer(i *Invoice, password string) (c *Customer, err error) {
+	id := strings.TrimSpace(i.Customer)
+	if id == "" {
+		return
+	}
+	r, err := ReadCustomerRegistry(password)
+	if err != nil {
+		return
+	}
+	if c, err = r.Get(id); err != nil {
+		err = fmt.Errorf("customer %s: %v", id, err)
+		return
+	}
+	c.apply(i)
+	return
+}
+
+// invoiceTemplatePath returns the template of an invoice when it has not been chosen with --template:
+// the template of the customer, or the one of the sender profile, or the default one
+func invoiceTemplatePath(c *Customer, templatePath string) (string, error) {
+	if config.TemplateName != config.DefaultTemplateName {
+		return templatePath, nil
+	}
+	var name string
+	switch {
+	case c != nil && c.Template != "":
+		name = c.Template
+	case activeProfile != nil && activeProfile.Template != "":
+		name = activeProfile.Template
+	default:
+		return templatePath, nil
+	}
+	tp, exists := config.GetTemplatePath(name)
+	if !exists {
+		return tp, fmt.Errorf("template %s not found", tp)
+	}
+	return tp, nil
+}
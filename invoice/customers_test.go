@@ -0,0 +1,156 @@
+package invoice
+
+import (
+	"os"
+	"testing"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+func TestCustomerRegistry(t *testing.T) {
+	var r CustomerRegistry
+	ids := map[string]string{
+		"ACME GmbH":     "acme-gmbh",
+		" acme  gmbh! ": "acme-gmbh-2",
+		"Müller & Co.":  "m-ller-co",
+		"!!!":           "customer",
+	}
+	for _, name := range []string{"ACME GmbH", " acme  gmbh! ", "Müller & Co.", "!!!"} {
+		id, err := r.Add(Customer{Recipient: Recipient{Name: name}})
+		if err != nil || id != ids[name] {
+			t.Error("expected", ids[name], "found", id, err)
+		}
+	}
+	if _, err := r.Add(Customer{Id: "acme-gmbh", Recipient: Recipient{Name: "ACME"}}); err != ErrCustomerExists {
+		t.Error("expected", ErrCustomerExists, "found", err)
+	}
+	invalid := []Customer{
+		{Id: "ACME", Recipient: Recipient{Name: "ACME"}},
+		{Id: "beta"},
+		{Id: "beta", Recipient: Recipient{Name: "Beta"}, Currency: "EURO"},
+		{Id: "beta", Recipient: Recipient{Name: "Beta"}, TaxTreatment: "zero"},
+		{Id: "beta", Recipient: Recipient{Name: "Beta"}, TaxTreatment: config.TaxExempt},
+		{Id: "beta", Recipient: Recipient{Name: "Beta"}, PaymentTerms: -1},
+	}
+	for _, c := range invalid {
+		if _, err := r.Add(c); err == nil {
+			t.Error("unexpected", nil, "as error for", c)
+		}
+	}
+	if err := r.Remove("customer"); err != nil || len(r.Customers) != 3 {
+		t.Error("expected", 3, "found", len(r.Customers), err)
+	}
+	if err := r.Remove("customer"); err != ErrCustomerNotFound {
+		t.Error("expected", ErrCustomerNotFound, "found", err)
+	}
+	if _, err := r.Get("customer"); err != ErrCustomerNotFound {
+		t.Error("expected", ErrCustomerNotFound, "found", err)
+	}
+}
+
+func TestResolveCustomer(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	if _, _, err := Setup(tmpWorkspace); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+
+	r, err := ReadCustomerRegistry("password")
+	if err != nil || len(r.Customers) != 0 {
+		t.Fatal("expected", 0, "found", len(r.Customers), err)
+	}
+	c := Customer{
+		Recipient:    Recipient{Name: "ACME GmbH", Country: "Germany", VatNumber: "DE123456789"},
+		HourlyRate:   60,
+		Currency:     "usd",
+		PaymentTerms: 30,
+		Language:     "de",
+	}
+	if _, err = r.Add(c); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if err = WriteCustomerRegistry(&r, "password"); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if _, err = ReadCustomerRegistry("wrong"); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+	// the registry is rekeyed with the descriptors
+	names, _ := encryptedFiles()
+	if len(names) != 1 || names[0] != config.CustomerRegistryFileName+"."+config.ExtRegistry {
+		t.Error("expected", config.CustomerRegistryFileName, "found", names)
+	}
+
+	i := masterInvoice()
+	i.Invoice.Date = "01.02.2026"
+	i.Invoice.Due = ""
+	i.Settings.ItemsPrice = 0
+	i.Settings.Currency = ""
+	i.Settings.Language = ""
+	if found, err := resolveCustomer(&i, "password"); err != nil || found != nil {
+		t.Error("expected", nil, "found", found, err)
+	}
+	i.Customer = "acme-gmbh"
+	found, err := resolveCustomer(&i, "password")
+	if err != nil || found == nil || found.Id != "acme-gmbh" {
+		t.Fatal("expected", "acme-gmbh", "found", found, err)
+	}
+	if i.To != c.Recipient || i.Settings.ItemsPrice != 60 || i.Settings.Currency != "USD" || i.Settings.Language != "de" {
+		t.Error("unexpected invoice", i.To, i.Settings)
+	}
+	if i.Invoice.Due != "03.03.2026" {
+		t.Error("expected", "03.03.2026", "found", i.Invoice.Due)
+	}
+	// without a template the default one is used
+	if tp, err := invoiceTemplatePath(found, "default.toml"); err != nil || tp != "default.toml" {
+		t.Error("expected", "default.toml", "found", tp, err)
+	}
+
+	// the settings of the master are not replaced by the defaults of the customer
+	m := masterInvoice()
+	m.Customer = "acme-gmbh"
+	m.Settings.Currency = "CHF"
+	m.Settings.ItemsPrice = 80
+	m.Settings.Language = ""
+	if _, err = resolveCustomer(&m, "password"); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if m.Settings.ItemsPrice != 80 || m.Settings.Currency != "CHF" || m.Settings.Language != "de" {
+		t.Error("unexpected invoice", m.Settings)
+	}
+	if m.Invoice.Due != "23.02.2017" {
+		t.Error("expected", "23.02.2017", "found", m.Invoice.Due)
+	}
+
+	i.Customer = "beta"
+	if _, err = resolveCustomer(&i, "password"); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+}
+
+func TestNewCustomerRegistryPassword(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	if _, _, err := Setup(tmpWorkspace); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	writeTestDescriptors(t, "password", "0001")
+
+	// a new registry is not encrypted with a password different from the one of the descriptors
+	r := CustomerRegistry{}
+	if _, err := r.Add(Customer{Recipient: Recipient{Name: "ACME GmbH"}}); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if err := WriteCustomerRegistry(&r, "wrong"); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+	if p, exists := config.GetCustomerRegistryPath(); exists {
+		t.Error("unexpected registry", p)
+	}
+	if err := WriteCustomerRegistry(&r, "password"); err != nil {
+		t.Error("unexpected", err, "as error")
+	}
+	if found, err := ReadCustomerRegistry("password"); err != nil || len(found.Customers) != 1 {
+		t.Error("expected", 1, "found", len(found.Customers), err)
+	}
+}
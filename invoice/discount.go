@@ -0,0 +1,47 @@
+package invoice
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// Discount is a percentage and/or a fixed amount subtracted from a cost,
+// the percentage is applied first
+type Discount struct {
+	Percent float64 `json:"percent,omitempty"`
+	Amount  float64 `json:"amount,omitempty"`
+}
+
+// IsEmpty tells if the discount does not reduce the cost
+func (d *Discount) IsEmpty() bool {
+	return d == nil || (d.Percent == 0 && d.Amount == 0)
+}
+
+// Label returns the description of the discount (ex. "10.00 %")
+func (d *Discount) Label() string {
+	if d.IsEmpty() || d.Percent == 0 {
+		return ""
+	}
+	return fmt.Sprint(strconv.FormatFloat(d.Percent, 'f', 2, 64), " %")
+}
+
+// apply computes the exact discount on a cost, the discount is never greater than the cost
+func (d *Discount) apply(cost *big.Rat) *big.Rat {
+	discount := new(big.Rat)
+	if d.IsEmpty() || cost.Sign() == 0 {
+		return discount
+	}
+	// computed on the absolute cost: for credit notes the costs are negative, so is the discount
+	abs := new(big.Rat).Abs(cost)
+	discount.Mul(abs, decimalRat(d.Percent))
+	discount.Quo(discount, big.NewRat(100, 1))
+	discount.Add(discount, decimalRat(d.Amount))
+	if discount.Cmp(abs) > 0 {
+		discount.Set(abs)
+	}
+	if cost.Sign() < 0 {
+		discount.Neg(discount)
+	}
+	return discount
+}
@@ -0,0 +1,264 @@
+package invoice
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"gitlab.com/almost_cc/govoice/config"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Errors returned when decrypting an invoice descriptor
+var (
+	ErrInvalidPassword             = errors.New("invalid password")
+	ErrDescriptorTampered          = errors.New("invoice descriptor is corrupted or has been tampered with")
+	ErrUnsupportedDescriptorFormat = errors.New("unsupported invoice descriptor format")
+	ErrInvalidKdfParams            = errors.New("invalid key derivation parameters, the scrypt cost is at most 22, the parallelization at most 16 and the memory at most 1 GiB")
+)
+
+// The encrypted descriptor envelope is composed by a header followed by the
+// encrypted payload. All the integers are big endian.
+//
+//	magic    6 bytes  "GVDESC"
+//	version  1 byte   envelope version
+//	cipher   1 byte   AEAD used to encrypt the payload
+//	kdf      1 byte   key derivation function
+//	logN     1 byte   scrypt cost (N = 1 << logN)
+//	r        4 bytes  scrypt block size
+//	p        4 bytes  scrypt parallelization
+//	salt     16 bytes random salt for the key derivation
+//	check    32 bytes HMAC-SHA256 of the header fields above, tells a wrong password from tampering
+//	nonce    12 bytes AEAD nonce
+//
+// the whole header is authenticated as additional data of the AEAD.
+const (
+	envelopeMagic    = "GVDESC"
+	envelopeVersion1 = 1
+
+	cipherAES256GCM = 1
+	kdfScrypt       = 1
+
+	envelopeSaltSize  = 16
+	envelopeKeySize   = 32
+	envelopeCheckSize = sha256.Size
+	envelopeNonceSize = 12
+	envelopeKdfSize   = 9
+	envelopeHeadSize  = len(envelopeMagic) + 3 + envelopeKdfSize + envelopeSaltSize + envelopeCheckSize + envelopeNonceSize
+)
+
+// kdfParams are the scrypt cost parameters
+type kdfParams struct {
+	LogN uint8
+	R    uint32
+	P    uint32
+}
+
+// Limits of the key derivation, so that a corrupted or tampered header cannot make scrypt
+// allocate or compute without bounds. scrypt uses 128·r·N bytes of memory for the cost and
+// 128·r·p bytes for the parallelization, both are limited to kdfMaxMemory (1 GiB)
+const (
+	kdfMaxLogN            = 22
+	kdfMaxParallelization = 16
+	kdfMaxMemory          = 1 << 30
+)
+
+// defaultKdfParams are the parameters used for newly encrypted descriptors
+// when they are not set in the configuration
+var defaultKdfParams = kdfParams{LogN: 15, R: 8, P: 1}
+
+// valid tells if the parameters are within the limits of the key derivation
+func (k kdfParams) valid() bool {
+	if k.LogN == 0 || k.LogN > kdfMaxLogN || k.R == 0 || k.P == 0 || k.P > kdfMaxParallelization {
+		return false
+	}
+	r, n, p := uint64(k.R), uint64(1)<<k.LogN, uint64(k.P)
+	return r*n <= kdfMaxMemory/128 && r*p <= kdfMaxMemory/128
+}
+
+// with returns the parameters with the cost, the block size and the parallelization
+// that are set (greater than 0), the ones of k for the others
+func (k kdfParams) with(cost, blockSize, parallelization int) (kdfParams, error) {
+	if cost < 0 || cost > kdfMaxLogN || blockSize < 0 || blockSize > kdfMaxMemory/128 ||
+		parallelization < 0 || parallelization > kdfMaxParallelization {
+		return k, ErrInvalidKdfParams
+	}
+	if cost > 0 {
+		k.LogN = uint8(cost)
+	}
+	if blockSize > 0 {
+		k.R = uint32(blockSize)
+	}
+	if parallelization > 0 {
+		k.P = uint32(parallelization)
+	}
+	if !k.valid() {
+		return k, ErrInvalidKdfParams
+	}
+	return k, nil
+}
+
+// currentKdfParams returns the key derivation parameters from the configuration,
+// using the defaults for the values that are not set or out of the limits
+func currentKdfParams() (k kdfParams) {
+	k, err := defaultKdfParams.with(config.Govoice.KdfCost, config.Govoice.KdfBlockSize, config.Govoice.KdfParallelization)
+	if err != nil {
+		return defaultKdfParams
+	}
+	return
+}
+
+// envelopeHeader is the header of an encrypted descriptor
+type envelopeHeader struct {
+	Version   uint8
+	Cipher    uint8
+	Kdf       uint8
+	KdfParams kdfParams
+	Salt      []byte
+	Check     []byte
+	Nonce     []byte
+}
+
+// prefix returns the header fields covered by the key check
+func (h *envelopeHeader) prefix() []byte {
+	var b bytes.Buffer
+	b.WriteString(envelopeMagic)
+	b.Write([]byte{h.Version, h.Cipher, h.Kdf, h.KdfParams.LogN})
+	binary.Write(&b, binary.BigEndian, h.KdfParams.R)
+	binary.Write(&b, binary.BigEndian, h.KdfParams.P)
+	b.Write(h.Salt)
+	return b.Bytes()
+}
+
+// bytes returns the serialized header
+func (h *envelopeHeader) bytes() []byte {
+	b := h.prefix()
+	b = append(b, h.Check...)
+	return append(b, h.Nonce...)
+}
+
+// isEnvelope tells if the data is an encrypted envelope or a legacy descriptor
+func isEnvelope(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(envelopeMagic))
+}
+
+// envelopeVersion returns the version of the envelope, 0 for a legacy descriptor
+func envelopeVersion(data []byte) uint8 {
+	if !isEnvelope(data) || len(data) <= len(envelopeMagic) {
+		return 0
+	}
+	return data[len(envelopeMagic)]
+}
+
+// parseEnvelopeHeader reads the header of an envelope, returns the header and the encrypted payload
+func parseEnvelopeHeader(data []byte) (h envelopeHeader, payload []byte, err error) {
+	if !isEnvelope(data) || len(data) < envelopeHeadSize {
+		err = ErrUnsupportedDescriptorFormat
+		return
+	}
+	p := data[len(envelopeMagic):]
+	h.Version, h.Cipher, h.Kdf = p[0], p[1], p[2]
+	if h.Version != envelopeVersion1 || h.Cipher != cipherAES256GCM || h.Kdf != kdfScrypt {
+		err = ErrUnsupportedDescriptorFormat
+		return
+	}
+	p = p[3:]
+	h.KdfParams.LogN = p[0]
+	h.KdfParams.R = binary.BigEndian.Uint32(p[1:5])
+	h.KdfParams.P = binary.BigEndian.Uint32(p[5:9])
+	p = p[envelopeKdfSize:]
+	h.Salt, p = p[:envelopeSaltSize], p[envelopeSaltSize:]
+	h.Check, p = p[:envelopeCheckSize], p[envelopeCheckSize:]
+	h.Nonce, payload = p[:envelopeNonceSize], p[envelopeNonceSize:]
+	return
+}
+
+// deriveKeys derive the encryption key and the key used for the password check
+func deriveKeys(password string, h *envelopeHeader) (encKey, checkKey []byte, err error) {
+	k := h.KdfParams
+	if !k.valid() {
+		err = ErrUnsupportedDescriptorFormat
+		return
+	}
+	key, err := scrypt.Key([]byte(password), h.Salt, 1<<k.LogN, int(k.R), int(k.P), 2*envelopeKeySize)
+	if err != nil {
+		err = ErrUnsupportedDescriptorFormat
+		return
+	}
+	return key[:envelopeKeySize], key[envelopeKeySize:], nil
+}
+
+// keyCheck compute the password check for the header
+func keyCheck(checkKey []byte, h *envelopeHeader) []byte {
+	mac := hmac.New(sha256.New, checkKey)
+	mac.Write(h.prefix())
+	return mac.Sum(nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealEnvelope encrypts the plaintext with a key derived from the password
+func sealEnvelope(password string, plaintext []byte, params kdfParams) (data []byte, err error) {
+	h := envelopeHeader{
+		Version:   envelopeVersion1,
+		Cipher:    cipherAES256GCM,
+		Kdf:       kdfScrypt,
+		KdfParams: params,
+		Salt:      make([]byte, envelopeSaltSize),
+		Nonce:     make([]byte, envelopeNonceSize),
+	}
+	if _, err = io.ReadFull(rand.Reader, h.Salt); err != nil {
+		return
+	}
+	if _, err = io.ReadFull(rand.Reader, h.Nonce); err != nil {
+		return
+	}
+	encKey, checkKey, err := deriveKeys(password, &h)
+	if err != nil {
+		return
+	}
+	h.Check = keyCheck(checkKey, &h)
+	aead, err := newGCM(encKey)
+	if err != nil {
+		return
+	}
+	header := h.bytes()
+	return aead.Seal(header, h.Nonce, plaintext, header), nil
+}
+
+// openEnvelope decrypts an envelope, returns ErrInvalidPassword if the password
+// does not match and ErrDescriptorTampered if the content fails the authentication
+func openEnvelope(password string, data []byte) (plaintext []byte, err error) {
+	h, payload, err := parseEnvelopeHeader(data)
+	if err != nil {
+		return
+	}
+	encKey, checkKey, err := deriveKeys(password, &h)
+	if err != nil {
+		return
+	}
+	if !hmac.Equal(h.Check, keyCheck(checkKey, &h)) {
+		err = ErrInvalidPassword
+		return
+	}
+	aead, err := newGCM(encKey)
+	if err != nil {
+		return
+	}
+	if plaintext, err = aead.Open(nil, h.Nonce, payload, data[:envelopeHeadSize]); err != nil {
+		err = ErrDescriptorTampered
+	}
+	return
+}
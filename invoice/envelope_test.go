@@ -0,0 +1,167 @@
+package invoice
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+func TestMain(m *testing.M) {
+	// keep the key derivation cheap, the tests encrypt thousands of descriptors
+	defaultKdfParams = kdfParams{LogN: 4, R: 8, P: 1}
+	os.Exit(m.Run())
+}
+
+func TestEnvelope(t *testing.T) {
+	plaintext := []byte(`{"invoice":{"number":"0001"}}`)
+	password := "a long passphrase, longer than the old 32 characters limit"
+
+	data, err := sealEnvelope(password, plaintext, defaultKdfParams)
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if !isEnvelope(data) {
+		t.Error("expected envelope magic in", data[:len(envelopeMagic)])
+	}
+	// the same plaintext must produce different ciphertexts
+	data2, _ := sealEnvelope(password, plaintext, defaultKdfParams)
+	if bytes.Equal(data, data2) {
+		t.Error("expected different ciphertexts for the same plaintext")
+	}
+
+	out, err := openEnvelope(password, data)
+	if err != nil {
+		t.Error("unexpected", err, "as error")
+	}
+	if !bytes.Equal(out, plaintext) {
+		t.Error("expected", string(plaintext), "found", string(out))
+	}
+
+	if _, err = openEnvelope("wrong password", data); err != ErrInvalidPassword {
+		t.Error("expected", ErrInvalidPassword, "found", err)
+	}
+
+	// tamper with the payload
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-1] ^= 0x01
+	if _, err = openEnvelope(password, tampered); err != ErrDescriptorTampered {
+		t.Error("expected", ErrDescriptorTampered, "found", err)
+	}
+	// tamper with the nonce (authenticated as header)
+	tampered = append([]byte{}, data...)
+	tampered[envelopeHeadSize-1] ^= 0x01
+	if _, err = openEnvelope(password, tampered); err != ErrDescriptorTampered {
+		t.Error("expected", ErrDescriptorTampered, "found", err)
+	}
+	// unknown version
+	tampered = append([]byte{}, data...)
+	tampered[len(envelopeMagic)] = 99
+	if _, err = openEnvelope(password, tampered); err != ErrUnsupportedDescriptorFormat {
+		t.Error("expected", ErrUnsupportedDescriptorFormat, "found", err)
+	}
+	// truncated
+	if _, err = openEnvelope(password, data[:envelopeHeadSize-1]); err != ErrUnsupportedDescriptorFormat {
+		t.Error("expected", ErrUnsupportedDescriptorFormat, "found", err)
+	}
+}
+
+func TestWriteInvoiceDescriptorEncrypted(t *testing.T) {
+	tmpHome, _ := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+
+	cwd, _ := os.Getwd()
+	i, err := readInvoiceDescriptor(path.Join(cwd, "_testresources", "0001.json"))
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+
+	p := path.Join(tmpHome, "0001.json.cfb")
+	if err = writeInvoiceDescriptorEncrypted(&i, p, "12345678"); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+
+	i2, err := readInvoiceDescriptorEncrypted(p, "12345678")
+	if err != nil {
+		t.Error("unexpected", err, "as error")
+	}
+	if i2.Invoice.Number != i.Invoice.Number {
+		t.Error("expected", i.Invoice.Number, "found", i2.Invoice.Number)
+	}
+
+	if _, err = readInvoiceDescriptorEncrypted(p, "87654321"); err != ErrInvalidPassword {
+		t.Error("expected", ErrInvalidPassword, "found", err)
+	}
+}
+
+func TestCurrentKdfParams(t *testing.T) {
+	defer func(c config.MainConfig) { config.Govoice = c }(config.Govoice)
+
+	config.Govoice = config.MainConfig{}
+	if k := currentKdfParams(); k != defaultKdfParams {
+		t.Error("expected", defaultKdfParams, "found", k)
+	}
+
+	config.Govoice = config.MainConfig{KdfCost: 5, KdfBlockSize: 4, KdfParallelization: 2}
+	expected := kdfParams{LogN: 5, R: 4, P: 2}
+	if k := currentKdfParams(); k != expected {
+		t.Error("expected", expected, "found", k)
+	}
+
+	// the envelope records the parameters used, changing the configuration
+	// does not affect the existing descriptors
+	data, _ := sealEnvelope("password", []byte("{}"), currentKdfParams())
+	config.Govoice = config.MainConfig{}
+	if _, err := openEnvelope("password", data); err != nil {
+		t.Error("unexpected", err, "as error")
+	}
+}
+
+func TestKdfParamsLimits(t *testing.T) {
+	defer func(c config.MainConfig) { config.Govoice = c }(config.Govoice)
+
+	// the parameters of a tampered header are rejected before running scrypt
+	data, err := sealEnvelope("password", []byte("{}"), defaultKdfParams)
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	offset := len(envelopeMagic) + 3
+	tampered := [][]byte{
+		// logN = 30
+		append(append(append([]byte{}, data[:offset]...), 30), data[offset+1:]...),
+		// r = 0xffffffff
+		append(append(append([]byte{}, data[:offset+1]...), 0xff, 0xff, 0xff, 0xff), data[offset+5:]...),
+		// p = 0xffffffff
+		append(append(append([]byte{}, data[:offset+5]...), 0xff, 0xff, 0xff, 0xff), data[offset+9:]...),
+	}
+	for _, d := range tampered {
+		if _, err = openEnvelope("password", d); err != ErrUnsupportedDescriptorFormat {
+			t.Error("expected", ErrUnsupportedDescriptorFormat, "found", err)
+		}
+	}
+
+	// the configuration out of the limits uses the defaults
+	for _, c := range []config.MainConfig{
+		{KdfCost: 30},
+		{KdfBlockSize: 1 << 40},
+		{KdfParallelization: 1 << 20},
+		{KdfCost: 22, KdfBlockSize: 64},
+	} {
+		config.Govoice = c
+		if k := currentKdfParams(); k != defaultKdfParams {
+			t.Error("expected", defaultKdfParams, "found", k, "for", c)
+		}
+	}
+
+	config.Govoice = config.MainConfig{}
+	for _, o := range []RekeyOptions{{KdfCost: 30}, {KdfBlockSize: -1}, {KdfParallelization: 17}, {KdfCost: 22, KdfBlockSize: 64}} {
+		if _, err = o.kdfParams(); err != ErrInvalidKdfParams {
+			t.Error("expected", ErrInvalidKdfParams, "found", err, "for", o)
+		}
+	}
+	if k, err := (&RekeyOptions{KdfCost: 20}).kdfParams(); err != nil || k.LogN != 20 || k.R != defaultKdfParams.R {
+		t.Error("unexpected", k, err)
+	}
+}
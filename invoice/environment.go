@@ -10,16 +10,31 @@ import (
 type InvoiceTemplate struct {
 	Page     Page               `toml:"page"`
 	Sections map[string]Section `toml:"sections"`
+	// Header and Footer are rendered on every page with the PageData,
+	// the header y is from the top of the page and the footer y from the bottom
+	Header Section `toml:"header"`
+	Footer Section `toml:"footer"`
+	// Images are the images of the invoice, ex. the logo or a signature
+	Images map[string]Image `toml:"images"`
+	// PaymentCode is the EPC QR code of the payment (GiroCode)
+	PaymentCode PaymentCode `toml:"payment_code"`
 }
 
 type Page struct {
-	Orientation     string  `toml:"orientation"`
-	Size            string  `toml:"size"`
-	BackgroundColor []int   `toml:"background_color"`
-	FontColor       []int   `toml:"font_color"`
-	Margins         Margins `toml:"margins"`
-	Font            Font    `toml:"font"`
-	Table           Table   `toml:"table"`
+	// CreditNoteTitle replaces the title of the invoice section for credit notes
+	CreditNoteTitle string `toml:"credit_note_title"`
+	// TaxTreatmentNotes are the notes printed for the tax treatments, by treatment
+	TaxTreatmentNotes map[string]string `toml:"tax_treatment_notes"`
+	Orientation       string            `toml:"orientation"`
+	Size              string            `toml:"size"`
+	BackgroundColor   []int             `toml:"background_color"`
+	FontColor         []int             `toml:"font_color"`
+	Margins           Margins           `toml:"margins"`
+	Font              Font              `toml:"font"`
+	Table             Table             `toml:"table"`
+	// Background is the letterhead drawn on every page, an image (png or jpeg) or the first page of a pdf,
+	// relative to the templates home
+	Background string `toml:"background"`
 }
 
 type Margins struct {
@@ -39,21 +54,55 @@ type Font struct {
 	LineHeightH1     float64 `toml:"line_height_h1"`
 	LineHeightH2     float64 `toml:"line_height_h2"`
 	LineHeightSmall  float64 `toml:"line_height_small"`
+	// TrueType fonts of the family relative to the templates home, the core font of the family
+	// is used when they are not set
+	Regular string `toml:"regular"`
+	Bold    string `toml:"bold"`
+	Italic  string `toml:"italic"`
 }
 
 type Table struct {
-	Col1W                 float64  `toml:"col1w"`
-	Col2W                 float64  `toml:"col2w"`
-	Col3W                 float64  `toml:"col3w"`
-	Col4W                 float64  `toml:"col4w"`
-	HeadHeight            float64  `toml:"head_height"`
-	RowHeight             float64  `toml:"row_height"`
-	Header                []string `toml:"header"`
-	LabelTotal            string   `toml:"label_total"`
-	LabelSubtotal         string   `toml:"label_subtotal"`
-	LabelTax              string   `toml:"label_tax"`
-	HeaderFontColor       []int    `toml:"header_font_color"`
-	HeaderBackgroundColor []int    `toml:"header_background_color"`
+	Col1W         float64  `toml:"col1w"`
+	Col2W         float64  `toml:"col2w"`
+	Col3W         float64  `toml:"col3w"`
+	Col4W         float64  `toml:"col4w"`
+	HeadHeight    float64  `toml:"head_height"`
+	RowHeight     float64  `toml:"row_height"`
+	Header        []string `toml:"header"`
+	LabelTotal    string   `toml:"label_total"`
+	LabelSubtotal string   `toml:"label_subtotal"`
+	LabelTax      string   `toml:"label_tax"`
+	LabelDiscount string   `toml:"label_discount"`
+	// LabelsAdditionalTaxes are the labels of the additional taxes, by name
+	LabelsAdditionalTaxes map[string]string `toml:"labels_additional_taxes"`
+	HeaderFontColor       []int             `toml:"header_font_color"`
+	HeaderBackgroundColor []int             `toml:"header_background_color"`
+	// ContinuationTop is the distance from the top margin of the rows continued on a new page,
+	// to leave room for a letterhead; the rows are always below the header of the page
+	ContinuationTop float64 `toml:"continuation_top"`
+}
+
+// Image is an image of the template, positioned like the sections
+type Image struct {
+	// Path of the image (png or jpeg) relative to the templates home
+	Path string  `toml:"path"`
+	X    float64 `toml:"x"`
+	Y    float64 `toml:"y"`
+	// Width and Height of the image, when one is 0 it is computed from the other
+	Width  float64 `toml:"width"`
+	Height float64 `toml:"height"`
+	// KeepAspect fits the image in width and height keeping its proportions
+	KeepAspect bool `toml:"keep_aspect"`
+	// EveryPage draws the image on every page, only on the first one otherwise
+	EveryPage bool `toml:"every_page"`
+}
+
+// PaymentCode is the EPC QR code to pay the invoice with a banking app, it moves with the payments section
+type PaymentCode struct {
+	X float64 `toml:"x"`
+	Y float64 `toml:"y"`
+	// Size of the code, the code is not rendered when 0
+	Size float64 `toml:"size"`
 }
 
 // Section represents an pdf block
@@ -77,6 +126,15 @@ func Setup(workspace string) (configPath string, masterPath string, err error) {
 		DateInputFormat:   "%d.%m.%y",
 		SearchResultLimit: 50,
 		DefaultInvoiceNet: 30,
+		// key derivation
+		KdfCost:            int(defaultKdfParams.LogN),
+		KdfBlockSize:       int(defaultKdfParams.R),
+		KdfParallelization: int(defaultKdfParams.P),
+		// rounding
+		RoundingMode:  config.RoundingHalfUp,
+		RoundingScope: config.RoundingScopeLine,
+		// currencies
+		BaseCurrency: config.DefaultCurrency,
 	}
 	// first create directories
 	if err = os.MkdirAll(config.GetConfigHome(), 0770); err != nil {
@@ -123,11 +181,14 @@ func masterInvoice() (master Invoice) {
 		From:           Recipient{"My Name", "My Address", "My City", "My Post Code", "My Country", "My Tax ID", "My VAT Number", "My Email"},
 		To:             Recipient{"Customer Name", "Customer Address", "Customer City", "Customer Post Code", "Customer Country", "Customre Tax ID", "Customer VAT number", "Customer Email"},
 		PaymentDetails: BankCoordinates{"My Name", "My Bank Name", "My IBAN", "My BIC/SWIFT"},
-		Invoice:        InvoiceData{"0000000", "23.01.2017", "23.02.2017"},
-		Settings:       InvoiceSettings{45, "", 19, "€", "en", "", false},
+		Invoice:        InvoiceData{Number: "0000000", Date: "23.01.2017", Due: "23.02.2017"},
+		Settings:       InvoiceSettings{ItemsPrice: 45, VatRate: 19, Currency: config.DefaultCurrency, CurrencySymbol: "€", Language: "en"},
 		Dailytime:      Daily{Enabled: false},
-		Items:          &[]Item{Item{"item 1 description", 10, 0, ""}, Item{"item 2 description", 5, 60, ""}},
-		Notes:          []string{"first note", "second note"},
+		Items: &[]Item{
+			Item{Description: "item 1 description", Quantity: 10},
+			Item{Description: "item 2 description", Quantity: 5, Price: 60},
+		},
+		Notes: []string{"first note", "second note"},
 	}
 	return
 }
@@ -139,6 +200,13 @@ func defaultTemplate() (tpl InvoiceTemplate) {
 			FontColor:       []int{0, 0, 0},
 			Orientation:     "P",
 			Size:            "A4",
+			CreditNoteTitle: "CREDIT NOTE",
+			TaxTreatmentNotes: map[string]string{
+				config.TaxReverseCharge:  defaultTreatmentNotes[config.TaxReverseCharge],
+				config.TaxIntraCommunity: defaultTreatmentNotes[config.TaxIntraCommunity],
+				config.TaxExport:         defaultTreatmentNotes[config.TaxExport],
+				config.TaxExempt:         defaultTreatmentNotes[config.TaxExempt],
+			},
 			Font: Font{
 				Family:           "helvetica",
 				LineHeightH1:     8.0,
@@ -170,6 +238,11 @@ func defaultTemplate() (tpl InvoiceTemplate) {
 				LabelTotal:            "total",
 				LabelSubtotal:         "sbutotal",
 				LabelTax:              "tax",
+				LabelDiscount:         "discount",
+				LabelsAdditionalTaxes: map[string]string{
+					"withholding":     "withholding tax",
+					"social_security": "social security",
+				},
 			},
 		},
 	}
@@ -184,7 +257,7 @@ func defaultTemplate() (tpl InvoiceTemplate) {
 
 	tpl.Sections["invoice"] = Section{
 		Title:    "INVOICE",
-		Template: "N.      {{.Number}}\nDate: {{.Date}}\nDue:  {{.Due}}\n\t\t",
+		Template: "N.      {{.Number}}\nDate: {{.Date}}\nDue:  {{.Due}}\n{{if .CreditNoteOf}}Ref:  {{.CreditNoteOf}}{{end}}\n\t\t",
 		X:        140.0,
 		Y:        28.0,
 	}
@@ -210,5 +283,20 @@ func defaultTemplate() (tpl InvoiceTemplate) {
 		Y:        65.0,
 	}
 
+	tpl.Images = make(map[string]Image)
+
+	// the payment code is off until the size is set, the payment details are placeholders
+	tpl.PaymentCode = PaymentCode{
+		X:    140.0,
+		Y:    205.0,
+		Size: 0,
+	}
+
+	tpl.Footer = Section{
+		Template: "{{.Number}} - page {{.Page}}/{{.Pages}}",
+		X:        -1.0,
+		Y:        12.0,
+	}
+
 	return
 }
@@ -0,0 +1,153 @@
+package invoice
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Errors
+var (
+	ErrPaymentCodeCurrency = errors.New("the payment code is only for payments in EUR")
+	ErrPaymentCodeAmount   = errors.New("the amount of the payment code must be between 0.01 and 999999999.99")
+	ErrPaymentCodeAccount  = errors.New("the account holder and the IBAN are required for the payment code")
+	ErrPaymentCodeIban     = errors.New("the IBAN of the payment code is not valid")
+)
+
+const (
+	// fields of the EPC069-12 payload: service tag, version 002, UTF-8 and SEPA credit transfer
+	epcServiceTag     = "BCD"
+	epcVersion        = "002"
+	epcCharacterSet   = "1"
+	epcIdentification = "SCT"
+	epcCurrency       = "EUR"
+	// epcMaxName and epcMaxRemittance are the lengths of the beneficiary and of the remittance information
+	epcMaxName       = 70
+	epcMaxRemittance = 140
+	epcMaxAmount     = 99999999999
+	// epcImageSize is the size in pixels of the image of the code
+	epcImageSize = 512
+)
+
+// ibanLengths are the lengths of the IBANs of the countries of the IBAN registry
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16, "BG": 22, "BH": 22, "BR": 29,
+	"BY": 28, "CH": 21, "CR": 22, "CY": 28, "CZ": 24, "DE": 22, "DK": 18, "DO": 28, "EE": 20, "EG": 29,
+	"ES": 24, "FI": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23, "GL": 18, "GR": 27, "GT": 28,
+	"HR": 21, "HU": 28, "IE": 22, "IL": 23, "IQ": 23, "IS": 26, "IT": 27, "JO": 30, "KW": 30, "KZ": 20,
+	"LB": 28, "LC": 32, "LI": 21, "LT": 20, "LU": 20, "LV": 21, "MC": 27, "MD": 24, "ME": 22, "MK": 19,
+	"MR": 27, "MT": 31, "MU": 30, "NL": 18, "NO": 15, "PK": 24, "PL": 28, "PS": 29, "PT": 25, "QA": 29,
+	"RO": 24, "RS": 22, "SA": 24, "SC": 31, "SE": 24, "SI": 19, "SK": 24, "SM": 27, "ST": 25, "SV": 28,
+	"TL": 23, "TN": 24, "TR": 26, "UA": 29, "VA": 22, "VG": 24, "XK": 20,
+}
+
+// validIban checks the country, the length and the check digits (mod 97) of an IBAN without spaces
+func validIban(iban string) bool {
+	if len(iban) < 4 || ibanLengths[iban[:2]] != len(iban) {
+		return false
+	}
+	// the country and the check digits are moved to the end, the letters are 10 to 35
+	remainder := 0
+	for _, c := range iban[4:] + iban[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			remainder = (remainder*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			remainder = (remainder*100 + int(c-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+// epcPayload returns the payload of the EPC QR code (GiroCode) of a SEPA credit transfer
+// of amount to the account, with the reference as remittance information
+func epcPayload(account BankCoordinates, amount Money, reference string) (payload string, err error) {
+	if currencyOf(amount.Currency) != epcCurrency {
+		err = ErrPaymentCodeCurrency
+		return
+	}
+	if amount.Amount <= 0 || amount.Amount > epcMaxAmount {
+		err = ErrPaymentCodeAmount
+		return
+	}
+	name := epcField(account.AccountHolder, epcMaxName)
+	iban := strings.ToUpper(strings.Replace(account.Iban, " ", "", -1))
+	if name == "" || iban == "" {
+		err = ErrPaymentCodeAccount
+		return
+	}
+	if !validIban(iban) {
+		err = ErrPaymentCodeIban
+		return
+	}
+	payload = strings.Join([]string{
+		epcServiceTag,
+		epcVersion,
+		epcCharacterSet,
+		epcIdentification,
+		strings.ToUpper(strings.Replace(account.Bic, " ", "", -1)),
+		name,
+		iban,
+		epcCurrency + amount.String(),
+		// purpose and structured reference are not used
+		"",
+		"",
+		epcField(reference, epcMaxRemittance),
+	}, "\n")
+	return
+}
+
+// epcField returns a single line value of the payload, truncated to max characters
+func epcField(value string, max int) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if r := []rune(value); len(r) > max {
+		value = string(r[:max])
+	}
+	return value
+}
+
+// renderPaymentCode draws the EPC QR code of the payment of the invoice at the
+// position of the template, x and y are from the margins
+func renderPaymentCode(pdf *gofpdf.Fpdf, code *PaymentCode, page *Page, invoice *Invoice, offset float64) (err error) {
+	_, total := invoice.GetTotals()
+	total.Currency = invoice.Settings.Currency
+	payload, err := epcPayload(invoice.PaymentDetails, total, invoice.Invoice.Number)
+	if err != nil {
+		return
+	}
+	// the EPC guidelines require the error correction level M
+	c, err := qr.Encode(payload, qr.M, qr.Unicode)
+	if err != nil {
+		return
+	}
+	if c, err = barcode.Scale(c, epcImageSize, epcImageSize); err != nil {
+		return
+	}
+	// 8 bit gray image, gofpdf does not read 16 bit png
+	gray := image.NewGray(c.Bounds())
+	draw.Draw(gray, gray.Bounds(), c, c.Bounds().Min, draw.Src)
+	var img bytes.Buffer
+	if err = png.Encode(&img, gray); err != nil {
+		return
+	}
+	name := fmt.Sprint("epc-", invoice.Invoice.Number)
+	opts := gofpdf.ImageOptions{ImageType: "PNG"}
+	if pdf.RegisterImageOptionsReader(name, opts, &img); !pdf.Ok() {
+		return pdf.Error()
+	}
+	x := math.Max(code.X, 0) + page.Margins.Left
+	y := math.Max(code.Y, 0) + page.Margins.Top + offset
+	pdf.ImageOptions(name, x, y, code.Size, code.Size, false, opts, 0, "")
+	return pdf.Error()
+}
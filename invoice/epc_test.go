@@ -0,0 +1,83 @@
+package invoice
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+func TestEpcPayload(t *testing.T) {
+	account := BankCoordinates{AccountHolder: "Sender  GmbH", Iban: "DE89 3704 0044 0532 0130 00", Bic: "cobadeffxxx"}
+	payload, err := epcPayload(account, Money{Amount: 142800, Currency: "EUR"}, "2026-0014")
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	expected := "BCD\n002\n1\nSCT\nCOBADEFFXXX\nSender GmbH\nDE89370400440532013000\nEUR1428.00\n\n\n2026-0014"
+	if payload != expected {
+		t.Error("expected", expected, "found", payload)
+	}
+	// the remittance information is truncated
+	payload, _ = epcPayload(account, Money{Amount: 1}, strings.Repeat("x", 200))
+	if lines := strings.Split(payload, "\n"); lines[7] != "EUR0.01" || len(lines[10]) != 140 {
+		t.Error("unexpected payload", payload)
+	}
+
+	invalid := map[error]struct {
+		account BankCoordinates
+		amount  Money
+	}{
+		ErrPaymentCodeCurrency: {account, Money{Amount: 100, Currency: "USD"}},
+		ErrPaymentCodeAmount:   {account, Money{Amount: -100}},
+		ErrPaymentCodeAccount:  {BankCoordinates{AccountHolder: "Sender GmbH"}, Money{Amount: 100}},
+		ErrPaymentCodeIban:     {BankCoordinates{AccountHolder: "Sender GmbH", Iban: "My IBAN"}, Money{Amount: 100}},
+	}
+	for expected, p := range invalid {
+		if _, err = epcPayload(p.account, p.amount, "2026-0014"); err != expected {
+			t.Error("expected", expected, "found", err)
+		}
+	}
+}
+
+func TestValidIban(t *testing.T) {
+	ibans := map[string]bool{
+		"DE89370400440532013000":      true,
+		"GB82WEST12345698765432":      true,
+		"CH9300762011623852957":       true,
+		"DE88370400440532013000":      false, // check digits
+		"DE8937040044053201300":       false, // length
+		"XX89370400440532013000":      false, // country
+		"DE89 3704 0044 0532 0130 00": false, // spaces
+		"de89370400440532013000":      false,
+		"":                            false,
+	}
+	for iban, expected := range ibans {
+		if found := validIban(iban); found != expected {
+			t.Error("expected", expected, "for", iban, "found", found)
+		}
+	}
+}
+
+func TestRenderPaymentCode(t *testing.T) {
+	tpl := defaultTemplate()
+	tpl.PaymentCode.Size = 25
+	i := masterInvoice()
+	i.PaymentDetails = BankCoordinates{AccountHolder: "Sender GmbH", Iban: "DE89370400440532013000"}
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.AddPage()
+	if err := renderPaymentCode(pdf, &tpl.PaymentCode, &tpl.Page, &i, 0); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	var out bytes.Buffer
+	if err := pdf.Output(&out); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if !bytes.Contains(out.Bytes(), []byte("/Subtype /Image")) {
+		t.Error("expected", "/Subtype /Image", "in the pdf")
+	}
+	i.Settings.Currency = "USD"
+	if err := renderPaymentCode(pdf, &tpl.PaymentCode, &tpl.Page, &i, 0); err != ErrPaymentCodeCurrency {
+		t.Error("expected", ErrPaymentCodeCurrency, "found", err)
+	}
+}
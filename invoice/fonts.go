@@ -0,0 +1,59 @@
+package invoice
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// hasFonts tells if the font of the template has TrueType fonts
+func (f *Font) hasFonts() bool {
+	return f.Regular != ""
+}
+
+// loadFonts embeds the TrueType fonts of the template in the pdf with the name of the family,
+// the regular font is used for the missing styles
+func loadFonts(pdf *gofpdf.Fpdf, font *Font) (err error) {
+	if !font.hasFonts() {
+		return
+	}
+	if font.Family == "" {
+		return fmt.Errorf("the font family is required for the font %s", font.Regular)
+	}
+	styles := []struct {
+		style, name string
+	}{
+		{fontStyleNormal, font.Regular},
+		{fontStyleBold, font.Bold},
+		{fontStyleItalic, font.Italic},
+	}
+	for _, s := range styles {
+		name := s.name
+		if name == "" {
+			name = font.Regular
+		}
+		p, err := templateFilePath(name)
+		if err != nil {
+			return err
+		}
+		// read by path, gofpdf resolves the font files from its font dir
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if pdf.AddUTF8FontFromBytes(font.Family, s.style, data); !pdf.Ok() {
+			return fmt.Errorf("invalid font %s: %v", p, pdf.Error())
+		}
+	}
+	return
+}
+
+// textTranslator returns the function converting the text for the fonts of the page,
+// the TrueType fonts render UTF-8 text and the core fonts cp1252
+func textTranslator(pdf *gofpdf.Fpdf, page *Page) func(string) string {
+	if page.Font.hasFonts() {
+		return func(s string) string { return s }
+	}
+	return pdf.UnicodeTranslatorFromDescriptor("")
+}
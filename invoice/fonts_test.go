@@ -0,0 +1,98 @@
+package invoice
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+func TestTextTranslator(t *testing.T) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	page := defaultTemplate().Page
+	text := "Arsenije Djapić ₹"
+	// the core fonts are cp1252
+	if found := textTranslator(pdf, &page)(text); found == text {
+		t.Error("expected cp1252 text, found", found)
+	}
+	page.Font.Regular = "DejaVuSans.ttf"
+	if found := textTranslator(pdf, &page)(text); found != text {
+		t.Error("expected", text, "found", found)
+	}
+}
+
+func TestLoadFonts(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	if _, _, err := Setup(tmpWorkspace); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	font := defaultTemplate().Page.Font
+	// without TrueType fonts the core font is used
+	if err := loadFonts(gofpdf.New("P", "mm", "A4", ""), &font); err != nil {
+		t.Error("unexpected", err, "as error")
+	}
+	font.Regular = "missing.ttf"
+	if err := loadFonts(gofpdf.New("P", "mm", "A4", ""), &font); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+	font.Family = ""
+	if err := loadFonts(gofpdf.New("P", "mm", "A4", ""), &font); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+}
+
+// pdfStream matches the streams of a pdf file
+var pdfStream = regexp.MustCompile(`(?s)stream\r?\n(.*?)endstream`)
+
+// pdfText returns the content streams of a pdf file, decompressed
+func pdfText(data []byte) (text []byte) {
+	for _, m := range pdfStream.FindAllSubmatch(data, -1) {
+		r, err := zlib.NewReader(bytes.NewReader(m[1]))
+		if err != nil {
+			text = append(text, m[1]...)
+			continue
+		}
+		content, _ := ioutil.ReadAll(r)
+		text = append(text, content...)
+	}
+	return
+}
+
+func TestRenderPDFUTF8(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	if _, _, err := Setup(tmpWorkspace); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	text := "Arsenije Djapić ₹"
+	// a subset of DejaVu Sans Condensed with the latin glyphs and ₹
+	cwd, _ := os.Getwd()
+	tpl := defaultTemplate()
+	tpl.Page.Font.Family = "dejavu"
+	tpl.Page.Font.Regular = path.Join(cwd, "_testresources", "DejaVuSansCondensed.ttf")
+	tpl.Footer.Template = "{{.From.Name}}"
+	i := masterInvoice()
+	i.From.Name, i.To.Name = text, text
+	i.Items = &[]Item{{Description: text, Quantity: 1, Price: 10}}
+	pdfPath := path.Join(tmpWorkspace, "utf8.pdf")
+	RenderPDF(&i, pdfPath, &tpl)
+	data, err := ioutil.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	// the text is written as UTF-16 in the sections from and to, in the table and in the footer
+	var encoded bytes.Buffer
+	for _, r := range utf16.Encode([]rune(text)) {
+		encoded.Write([]byte{byte(r >> 8), byte(r)})
+	}
+	if found := bytes.Count(pdfText(data), encoded.Bytes()); found != 4 {
+		t.Error("expected", 4, "occurrences of", text, "found", found)
+	}
+}
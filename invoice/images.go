@@ -0,0 +1,135 @@
+package invoice
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/jung-kurt/gofpdf/contrib/gofpdi"
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+const (
+	extPdf = ".pdf"
+	// pdfMediaBox is the box of the pdf page imported as letterhead
+	pdfMediaBox = "/MediaBox"
+)
+
+// imageExts are the extensions of the images supported in the templates
+var imageExts = map[string]bool{".png": true, ".jpg": true, ".jpeg": true}
+
+// templateFilePath resolves the path of a file of the template, relative to the templates home
+func templateFilePath(name string) (p string, err error) {
+	p = name
+	if !filepath.IsAbs(p) {
+		p = path.Join(config.GetTemplatesHome(), p)
+	}
+	if !config.FileExists(p) {
+		err = fmt.Errorf("template file %s not found", p)
+	}
+	return
+}
+
+// fitImage computes the size of an image of width iw and height ih in a box of width w and height h,
+// when one of them is 0 it is computed from the other, both 0 is the size of the image
+func fitImage(iw, ih, w, h float64, keepAspect bool) (float64, float64) {
+	switch {
+	case w <= 0 && h <= 0:
+		return iw, ih
+	case w <= 0:
+		return iw * h / ih, h
+	case h <= 0:
+		return w, ih * w / iw
+	case keepAspect:
+		r := math.Min(w/iw, h/ih)
+		return iw * r, ih * r
+	}
+	return w, h
+}
+
+// renderImage draws an image of the template, a png or a jpeg
+func renderImage(pdf *gofpdf.Fpdf, img *Image, page *Page) (err error) {
+	p, err := templateImagePath(img.Path)
+	if err != nil {
+		return
+	}
+	x, y := math.Max(img.X, 0)+page.Margins.Left, math.Max(img.Y, 0)+page.Margins.Top
+	opts := gofpdf.ImageOptions{ReadDpi: true}
+	info := pdf.RegisterImageOptions(p, opts)
+	if info == nil {
+		return pdf.Error()
+	}
+	w, h := fitImage(info.Width(), info.Height(), img.Width, img.Height, img.KeepAspect)
+	pdf.ImageOptions(p, x, y, w, h, false, opts, 0, "")
+	return pdf.Error()
+}
+
+// templateImagePath resolves the path of an image of the template, only png and jpeg are supported
+func templateImagePath(name string) (p string, err error) {
+	if !imageExts[strings.ToLower(path.Ext(name))] {
+		err = fmt.Errorf("unsupported image %s, use a png or a jpeg", name)
+		return
+	}
+	return templateFilePath(name)
+}
+
+// renderImages draws the images of the template of the current page, sorted by name
+func renderImages(pdf *gofpdf.Fpdf, tpl *InvoiceTemplate) (err error) {
+	var names []string
+	for name := range tpl.Images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		img := tpl.Images[name]
+		if pdf.PageNo() > 1 && !img.EveryPage {
+			continue
+		}
+		if err = renderImage(pdf, &img, &tpl.Page); err != nil {
+			return fmt.Errorf("image %s: %v", name, err)
+		}
+	}
+	return
+}
+
+// loadLetterhead loads the background of the pages, an image (png or jpeg) or the first page
+// of a pdf, and returns the function drawing it on the whole page
+func loadLetterhead(pdf *gofpdf.Fpdf, background string) (draw func(), err error) {
+	isPdf := strings.ToLower(path.Ext(background)) == extPdf
+	var p string
+	if isPdf {
+		p, err = templateFilePath(background)
+	} else {
+		p, err = templateImagePath(background)
+	}
+	if err != nil {
+		return
+	}
+	w, h := pdf.GetPageSize()
+	if !isPdf {
+		opts := gofpdf.ImageOptions{ReadDpi: true}
+		if pdf.RegisterImageOptions(p, opts); !pdf.Ok() {
+			return nil, pdf.Error()
+		}
+		draw = func() {
+			pdf.ImageOptions(p, 0, 0, w, h, false, opts, 0, "")
+		}
+		return
+	}
+	// the pdf importer panics on invalid files
+	defer func() {
+		if r := recover(); r != nil {
+			draw, err = nil, fmt.Errorf("invalid letterhead %s: %v", p, r)
+		}
+	}()
+	importer := gofpdi.NewImporter()
+	id := importer.ImportPage(pdf, p, 1, pdfMediaBox)
+	draw = func() {
+		importer.UseImportedTemplate(pdf, id, 0, 0, w, h)
+	}
+	return
+}
@@ -0,0 +1,132 @@
+package invoice
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+func TestFitImage(t *testing.T) {
+	sizes := []struct {
+		w, h       float64
+		keepAspect bool
+		ew, eh     float64
+	}{
+		{0, 0, false, 200, 100},
+		{50, 0, false, 50, 25},
+		{0, 50, false, 100, 50},
+		{50, 50, false, 50, 50},
+		{50, 50, true, 50, 25},
+		{100, 20, true, 40, 20},
+	}
+	for _, s := range sizes {
+		if w, h := fitImage(200, 100, s.w, s.h, s.keepAspect); w != s.ew || h != s.eh {
+			t.Error("expected", s.ew, s.eh, "found", w, h)
+		}
+	}
+}
+
+func TestRenderImages(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	if _, _, err := Setup(tmpWorkspace); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	// a logo and a signature in the templates home
+	logo, err := os.Create(path.Join(config.GetTemplatesHome(), "logo.png"))
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	png.Encode(logo, image.NewRGBA(image.Rect(0, 0, 40, 20)))
+	logo.Close()
+	signature, err := os.Create(path.Join(config.GetTemplatesHome(), "signature.jpg"))
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	jpeg.Encode(signature, image.NewRGBA(image.Rect(0, 0, 100, 50)), nil)
+	signature.Close()
+
+	tpl := defaultTemplate()
+	tpl.Images = map[string]Image{
+		"logo":      {Path: "logo.png", X: 0, Y: 0, Width: 30, EveryPage: true},
+		"signature": {Path: "signature.jpg", X: 100, Y: 250, Width: 40},
+	}
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	draw, err := loadLetterhead(pdf, "logo.png")
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	pdf.AddPage()
+	draw()
+	if err = renderImages(pdf, &tpl); err != nil {
+		t.Error("unexpected", err, "as error")
+	}
+	var out bytes.Buffer
+	if err = pdf.Output(&out); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if !bytes.Contains(out.Bytes(), []byte("/Subtype /Image")) {
+		t.Error("expected", "/Subtype /Image", "in the pdf")
+	}
+
+	if _, err = loadLetterhead(gofpdf.New("P", "mm", "A4", ""), "missing.pdf"); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+	// the svg images are not supported
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" width="100" height="50"><path d="M 10 10 L 90 40"/></svg>`
+	if err = ioutil.WriteFile(path.Join(config.GetTemplatesHome(), "logo.svg"), []byte(svg), 0660); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if _, err = loadLetterhead(gofpdf.New("P", "mm", "A4", ""), "logo.svg"); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+	for _, missing := range []Image{{Path: "logo.svg"}, {Path: "missing.png"}} {
+		tpl.Images["missing"] = missing
+		pdf = gofpdf.New("P", "mm", "A4", "")
+		pdf.AddPage()
+		if err = renderImages(pdf, &tpl); err == nil {
+			t.Error("unexpected", nil, "as error")
+		}
+	}
+}
+
+func TestLetterheadPdf(t *testing.T) {
+	cwd, _ := os.Getwd()
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	draw, err := loadLetterhead(pdf, path.Join(cwd, "_testresources", "letterhead.pdf"))
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	// the first page of the pdf is drawn on every page as a form
+	pdf.AddPage()
+	draw()
+	pdf.AddPage()
+	draw()
+	var out bytes.Buffer
+	if err = pdf.Output(&out); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if !bytes.Contains(out.Bytes(), []byte("/Subtype /Form")) {
+		t.Error("expected", "/Subtype /Form", "in the pdf")
+	}
+
+	// not a pdf
+	invalid, err := ioutil.TempFile("", "letterhead*.pdf")
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	defer os.Remove(invalid.Name())
+	invalid.WriteString("not a pdf")
+	invalid.Close()
+	if _, err = loadLetterhead(gofpdf.New("P", "mm", "A4", ""), invalid.Name()); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+}
@@ -4,12 +4,10 @@ import (
 	"bufio"
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -33,6 +31,27 @@ func writeFile(path string, content []byte) (err error) {
 	return ioutil.WriteFile(path, content, os.FileMode(0660))
 }
 
+// writeFileAtomic write a file replacing the existing one only once
+// the new content is completely written on disk
+func writeFileAtomic(path string, content []byte) (err error) {
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(0660))
+	if err != nil {
+		return
+	}
+	if _, err = f.Write(content); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return
+	}
+	return os.Rename(tmpPath, path)
+}
+
 // ReadInvoice parse the json file for an invoice
 func readInvoiceDescriptor(path string) (i Invoice, err error) {
 	rawData, err := ioutil.ReadFile(path)
@@ -57,7 +76,10 @@ func readInvoiceDescriptorEncrypted(path, password string) (i Invoice, err error
 	if err != nil {
 		return
 	}
-	rawData = decryptCFB(password, &rawData)
+	rawData, err = decryptDescriptor(password, rawData)
+	if err != nil {
+		return
+	}
 	err = json.Unmarshal(rawData, &i)
 	return
 }
@@ -70,12 +92,16 @@ func writeInvoiceDescriptor(i *Invoice) {
 	}
 }
 
-func writeInvoiceDescriptorEncrypted(i *Invoice, jsonPath, password string) {
+func writeInvoiceDescriptorEncrypted(i *Invoice, jsonPath, password string) error {
 	content, err := json.MarshalIndent(*i, "", "  ")
-	if err == nil {
-		encContent := encryptCFB(password, &content)
-		writeFile(jsonPath, encContent)
+	if err != nil {
+		return err
+	}
+	encContent, err := encryptDescriptor(password, content)
+	if err != nil {
+		return err
 	}
+	return writeFile(jsonPath, encContent)
 }
 
 func writeTomlToFile(path string, v interface{}) error {
@@ -112,12 +138,11 @@ func ReadUserPassword(message string) (string, error) {
 	// password
 	fmt.Print(message)
 	bytePassword, _ := terminal.ReadPassword(int(syscall.Stdin))
-	// pad the key for aes encryption
-	password := fmt.Sprintf("%32s", strings.TrimSpace(string(bytePassword)))
-	if len(password) > 32 {
-		return "", errors.New("password is too long (max 32 characters)")
-	}
 	fmt.Println()
+	password := strings.TrimSpace(string(bytePassword))
+	if len(password) == 0 {
+		return "", errors.New("password cannot be empty")
+	}
 	return password, nil
 }
 
@@ -128,54 +153,71 @@ func ReadUserInput(message string) string {
 	return strings.TrimSpace(text)
 }
 
-func decryptCFB(k string, data *[]byte) []byte {
-	key := []byte(k)
-	ciphertext, _ := hex.DecodeString(string(*data))
+// encryptDescriptor encrypt the content of a descriptor for the recipients
+// in the configuration if any, otherwise with the password
+func encryptDescriptor(password string, content []byte) ([]byte, error) {
+	if usingRecipients() {
+		return sealForRecipients(config.Govoice.Recipients, content)
+	}
+	return sealEnvelope(password, content, currentKdfParams())
+}
 
-	block, err := aes.NewCipher(key)
+// decryptDescriptor decrypt the content of an encrypted descriptor, with the password
+// or the identities in the identity file for the descriptors encrypted for recipients.
+// Descriptors in the legacy CFB format are supported
+func decryptDescriptor(password string, data []byte) ([]byte, error) {
+	switch envelopeVersion(data) {
+	case 0:
+		// legacy format, handled below
+	case envelopeVersion2:
+		identities, err := readIdentities()
+		if err != nil {
+			return nil, err
+		}
+		return openForIdentities(identities, data)
+	default:
+		return openEnvelope(password, data)
+	}
+	plaintext, err := decryptCFB(password, &data)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-
-	// The IV needs to be unique, but not secure. Therefore it's common to
-	// include it at the beginning of the ciphertext.
-	if len(ciphertext) < aes.BlockSize {
-		panic("ciphertext too short")
+	// the legacy format is not authenticated, a wrong password produces garbage
+	if !json.Valid(plaintext) {
+		return nil, ErrInvalidPassword
 	}
-	iv := ciphertext[:aes.BlockSize]
-	ciphertext = ciphertext[aes.BlockSize:]
-
-	stream := cipher.NewCFBDecrypter(block, iv)
+	return plaintext, nil
+}
 
-	// XORKeyStream can work in-place if the two arguments are the same.
-	stream.XORKeyStream(ciphertext, ciphertext)
-	// Output: some plaintext
-	return ciphertext
+// legacyKey pads the password to the 32 bytes key used by the legacy format
+func legacyKey(password string) []byte {
+	return []byte(fmt.Sprintf("%32s", strings.TrimSpace(password)))
 }
 
-func encryptCFB(k string, plaintext *[]byte) []byte {
-	key := []byte(k)
+// decryptCFB decrypt the legacy descriptor format (hex encoded AES-CFB)
+func decryptCFB(k string, data *[]byte) ([]byte, error) {
+	key := legacyKey(k)
+	ciphertext, err := hex.DecodeString(strings.TrimSpace(string(*data)))
+	if err != nil {
+		return nil, ErrUnsupportedDescriptorFormat
+	}
 
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		panic(err)
+		return nil, ErrInvalidPassword
 	}
 
 	// The IV needs to be unique, but not secure. Therefore it's common to
 	// include it at the beginning of the ciphertext.
-	ciphertext := make([]byte, aes.BlockSize+len(*plaintext))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		panic(err)
+	if len(ciphertext) < aes.BlockSize {
+		return nil, ErrDescriptorTampered
 	}
+	iv := ciphertext[:aes.BlockSize]
+	ciphertext = ciphertext[aes.BlockSize:]
 
-	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], *plaintext)
+	stream := cipher.NewCFBDecrypter(block, iv)
 
-	// It's important to remember that ciphertexts must be authenticated
-	// (i.e. by using crypto/hmac) as well as being encrypted in order to
-	// be secure.
-	cypertexthex := make([]byte, hex.EncodedLen(len(ciphertext)))
-	hex.Encode(cypertexthex, ciphertext)
-	return cypertexthex
+	// XORKeyStream can work in-place if the two arguments are the same.
+	stream.XORKeyStream(ciphertext, ciphertext)
+	return ciphertext, nil
 }
@@ -28,8 +28,8 @@ func TestReadInvoiceDescriptorEncrypted(t *testing.T) {
 	var i Invoice
 	wrongPass := "                     xxxxxxxxxxx"
 	i, err := readInvoiceDescriptorEncrypted(path, wrongPass)
-	if err == nil {
-		t.Error("unexpected", nil, "as error")
+	if err != ErrInvalidPassword {
+		t.Error("expected", ErrInvalidPassword, "found", err)
 	}
 
 	rightPass := "                        12345678"
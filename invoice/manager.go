@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"math/big"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -17,19 +19,25 @@ var InvoiceDescriptorExists = errors.New("Invoice descriptor already exists")
 
 //Invoice contains all the information to generate an invoice
 type Invoice struct {
-	From           Recipient       `json:"from"`
+	// Profile is the name of the sender profile, its sender and payment details replace From and PaymentDetails
+	Profile string    `json:"profile,omitempty"`
+	From    Recipient `json:"from"`
+	// Customer is the id of a customer of the registry, its recipient
+	// and defaults replace To and the settings when rendering
+	Customer       string          `json:"customer,omitempty"`
 	To             Recipient       `json:"to"`
 	PaymentDetails BankCoordinates `json:"payment_details"`
 	Invoice        InvoiceData     `json:"invoice"`
 	Settings       InvoiceSettings `json:"settings"`
 	Dailytime      Daily           `json:"dailytime"`
 	Items          *[]Item         `json:"items"`
+	Discount       *Discount       `json:"discount,omitempty"`
 	Notes          []string        `json:"notes"`
 }
 
 // PushItem push an item to the list of the items of the invoice
 func (i *Invoice) PushItem(description string, quantity, price float64, quantitySymbol string) {
-	*i.Items = append(*i.Items, Item{description, quantity, price, quantitySymbol})
+	*i.Items = append(*i.Items, Item{Description: description, Quantity: quantity, Price: price, QuantitySymbol: quantitySymbol})
 }
 
 // DisableExtensions disable the extensions of the invoices
@@ -39,18 +47,108 @@ func (i *Invoice) DisableExtensions() {
 }
 
 // GetTotals calculate and retrieve the subtotal (without tax) and the total (with tax)
-// if the tax rate is 0 the subtotal and total are the same
-func (i *Invoice) GetTotals() (float64, float64) {
-	subtotal := 0.0
+// if the tax rate is 0 the subtotal and total are the same.
+// The subtotal is net of the items and invoice discounts, the total is the amount due,
+// with the additional taxes added or withheld
+func (i *Invoice) GetTotals() (subtotal, total Money) {
+	subtotal, _, taxes := i.computeTaxes()
+	total = subtotal
+	for _, t := range taxes {
+		total = total.Add(t.Amount)
+	}
+	for _, at := range i.additionalTaxes(subtotal, taxes) {
+		total = total.Add(at.Amount)
+	}
+	return
+}
+
+// Validate checks the currency, the tax treatment and the additional taxes of the invoice
+func (i *Invoice) Validate() error {
+	if err := i.ValidateCurrency(); err != nil {
+		return err
+	}
+	if err := i.ValidateTaxTreatment(); err != nil {
+		return err
+	}
+	return i.ValidateAdditionalTaxes()
+}
+
+// GetTaxes calculate the taxes of the invoice grouped by tax rate,
+// the groups are sorted by rate, highest first
+func (i *Invoice) GetTaxes() (taxes []TaxLine) {
+	_, _, taxes = i.computeTaxes()
+	return
+}
+
+// GetDiscount calculate the invoice discount, applied to the sum of the items
+// (after the items discounts) before the taxes
+func (i *Invoice) GetDiscount() (discount Money) {
+	_, discount, _ = i.computeTaxes()
+	return
+}
+
+// computeTaxes calculate the subtotal, the invoice discount and the taxes grouped by rate,
+// applying the rounding rules: the cost and the discount of each item are rounded (unless
+// the rounding is on the totals only), then the subtotal, the taxable amount and the tax
+// of each rate are rounded. The invoice discount is split among the rates proportionally
+func (i *Invoice) computeTaxes() (subtotal, discount Money, taxes []TaxLine) {
+	currency := i.Settings.Currency
+	subtotal.Currency, discount.Currency = currency, currency
+	if i.Items == nil {
+		return
+	}
+	r := newRounding(&i.Settings)
+	sum := new(big.Rat)
+	bases := make(map[float64]*big.Rat)
+	var rates []float64
 	for _, it := range *i.Items {
-		_, itemCost := it.GetCost(&i.Settings.ItemsPrice, &i.Settings.RoundQuantity)
-		subtotal += itemCost
+		cost := r.line(it.cost(&i.Settings))
+		cost.Sub(cost, r.line(it.Discount.apply(cost)))
+		sum.Add(sum, cost)
+		rate := it.GetTaxRate(&i.Settings)
+		if _, ok := bases[rate]; !ok {
+			bases[rate] = new(big.Rat)
+			rates = append(rates, rate)
+		}
+		bases[rate].Add(bases[rate], cost)
 	}
-	total := subtotal
-	if i.Settings.VatRate > 0 {
-		total += total * (i.Settings.VatRate / 100)
+	sort.Sort(sort.Reverse(sort.Float64Slice(rates)))
+
+	// split the invoice discount among the rates, the last one gets the remainder
+	d := r.line(i.Discount.apply(sum))
+	if d.Sign() != 0 {
+		left := new(big.Rat).Set(d)
+		for n, rate := range rates {
+			share := new(big.Rat).Set(left)
+			if n < len(rates)-1 {
+				share = r.line(new(big.Rat).Quo(new(big.Rat).Mul(d, bases[rate]), sum))
+			}
+			bases[rate].Sub(bases[rate], share)
+			left.Sub(left, share)
+		}
+		sum.Sub(sum, d)
 	}
-	return subtotal, total
+
+	for _, rate := range rates {
+		tax := new(big.Rat).Mul(bases[rate], decimalRat(rate))
+		tax.Quo(tax, big.NewRat(100, 1))
+		taxes = append(taxes, TaxLine{
+			Rate:   rate,
+			Base:   r.round(bases[rate], currency),
+			Amount: r.round(tax, currency),
+		})
+	}
+	subtotal = r.round(sum, currency)
+	discount = r.round(d, currency)
+	return
+}
+
+// TaxLine is the tax for a tax rate, the base is the sum of the cost
+// of the items with the rate
+type TaxLine struct {
+	Rate   float64
+	Base   Money
+	Amount Money
 }
 
 type Daily struct {
@@ -74,30 +172,46 @@ type InvoiceSettings struct {
 	Language            string  `json:"lang"`
 	DateInputFormat     string  `json:"date_format",omitempty`
 	RoundQuantity       bool    `json:"round_quantity",omitempty`
+	// ISO 4217 code of the currency, when empty the base currency of the configuration
+	Currency string `json:"currency,omitempty"`
+	// tax rates by category, for the items with a tax category
+	TaxCategories map[string]float64 `json:"tax_categories,omitempty"`
+	// rounding rules, when empty the ones in the configuration are used
+	RoundingMode  string `json:"rounding_mode,omitempty"`
+	RoundingScope string `json:"rounding_scope,omitempty"`
+	// tax treatment (standard, reverse_charge, intra_community, export or exempt),
+	// no vat is charged when not standard
+	TaxTreatment    string `json:"tax_treatment,omitempty"`
+	ExemptionReason string `json:"exemption_reason,omitempty"`
+	// taxes added or withheld after the vat
+	AdditionalTaxes []AdditionalTax `json:"additional_taxes,omitempty"`
 }
 
 type InvoiceData struct {
 	Number string `json:"number"`
+	Series string `json:"series,omitempty"`
 	Date   string `json:"date"`
 	Due    string `json:"due"`
+	// CreditNoteOf is the number of the invoice credited by this credit note
+	CreditNoteOf string `json:"credit_note_of,omitempty"`
 }
 
 type BankCoordinates struct {
-	AccountHolder string `json:"account_holder"`
-	Bank          string `json:"account_bank"`
-	Iban          string `json:"account_iban"`
-	Bic           string `json:"account_bic"`
+	AccountHolder string `json:"account_holder" toml:"account_holder"`
+	Bank          string `json:"account_bank" toml:"account_bank"`
+	Iban          string `json:"account_iban" toml:"account_iban"`
+	Bic           string `json:"account_bic" toml:"account_bic"`
 }
 
 type Recipient struct {
-	Name      string `json:"name"`
-	Address   string `json:"address"`
-	City      string `json:"city"`
-	AreaCode  string `json:"area_code"`
-	Country   string `json:"country"`
-	TaxId     string `json:"tax_id"`
-	VatNumber string `json:"vat_number"`
-	Email     string `json:"email"`
+	Name      string `json:"name" toml:"name"`
+	Address   string `json:"address" toml:"address"`
+	City      string `json:"city" toml:"city"`
+	AreaCode  string `json:"area_code" toml:"area_code"`
+	Country   string `json:"country" toml:"country"`
+	TaxId     string `json:"tax_id" toml:"tax_id"`
+	VatNumber string `json:"vat_number" toml:"vat_number"`
+	Email     string `json:"email" toml:"email"`
 }
 
 type Item struct {
@@ -105,20 +219,61 @@ type Item struct {
 	Quantity       float64 `json:"quantity"`
 	Price          float64 `json:"price,omitempty"`
 	QuantitySymbol string  `json:"quantity_symbol,omitempty"`
+	// tax rate of the item, when missing the rate of the tax category
+	// or the global vat rate is used (0 is a valid rate)
+	TaxRate     *float64 `json:"tax_rate,omitempty"`
+	TaxCategory string   `json:"tax_category,omitempty"`
+	// discount on the cost of the item
+	Discount *Discount `json:"discount,omitempty"`
+}
+
+// GetTaxRate return the tax rate of the item: the item tax rate if set,
+// otherwise the rate of the item tax category, otherwise the global vat rate.
+// The rate is 0 if the tax treatment of the invoice is not standard
+func (i *Item) GetTaxRate(settings *InvoiceSettings) float64 {
+	if settings.zeroRated() {
+		return 0
+	}
+	if i.TaxRate != nil {
+		return *i.TaxRate
+	}
+	if rate, ok := settings.TaxCategories[i.TaxCategory]; ok && i.TaxCategory != "" {
+		return rate
+	}
+	return settings.VatRate
 }
 
 //GetCost return the cost of an item, that is the ItemPrice multiplied the ItemQuantity.
 //if the ItemPrice of the item is 0 then the global item price will be used.
 // The function also rounds the quantity to the next .5 if it is specified in settings
-func (i *Item) GetCost(basePrice *float64, roundQuantity *bool) (unitCost, cost float64) {
+func (i *Item) GetCost(settings *InvoiceSettings) (unitCost, cost Money) {
+	r := newRounding(settings)
+	unitCost = r.round(decimalRat(i.price(settings)), settings.Currency)
+	cost = r.round(i.cost(settings), settings.Currency)
+	return
+}
+
+// GetDiscount return the discount on the cost of the item
+func (i *Item) GetDiscount(settings *InvoiceSettings) Money {
+	r := newRounding(settings)
+	return r.round(i.Discount.apply(r.line(i.cost(settings))), settings.Currency)
+}
+
+// price return the price of the item, or the global price if the item has no price
+func (i *Item) price(settings *InvoiceSettings) float64 {
+	if i.Price > 0 {
+		return i.Price
+	}
+	return settings.ItemsPrice
+}
+
+// cost return the exact (not rounded) cost of the item
+func (i *Item) cost(settings *InvoiceSettings) *big.Rat {
 	qt := i.Quantity
-	if *roundQuantity {
+	if settings.RoundQuantity {
 		qt = math.Ceil(i.Quantity*2) / 2
 	}
-	if i.Price > 0 {
-		return i.Price, i.Price * qt
-	}
-	return *basePrice, *basePrice * qt
+	return new(big.Rat).Mul(decimalRat(i.price(settings)), decimalRat(qt))
 }
 
 // FormatQuantity with a quantity symbol if present. it also rounds the quantity to the next .5
@@ -142,8 +297,9 @@ func (i *Item) FormatQuantity(quantitySymbol string, roundQuantity bool) string
 	return qt
 }
 
-// PreviewInvoice same as RenderInvoice but for previews
-func PreviewInvoice(templatePath string) (invoiceNumber string, err error) {
+// PreviewInvoice same as RenderInvoice but for previews,
+// the password is required only if the master descriptor references a customer
+func PreviewInvoice(password, templatePath string) (invoiceNumber string, err error) {
 	// check if master exists
 	descriptorPath, exists := config.GetMasterPath()
 	if !exists {
@@ -158,8 +314,25 @@ func PreviewInvoice(templatePath string) (invoiceNumber string, err error) {
 	}
 	// set the return invoice number
 	invoiceNumber = invoice.Invoice.Number
+	// resolve the sender profile and the customer
+	if err = resolveProfile(&invoice); err != nil {
+		return
+	}
+	c, err := resolveCustomer(&invoice, password)
+	if err != nil {
+		return
+	}
+	if templatePath, err = invoiceTemplatePath(c, templatePath); err != nil {
+		return
+	}
 	// load template
 	template, err := readInvoiceTemplate(templatePath)
+	if err != nil {
+		return
+	}
+	if err = invoice.Validate(); err != nil {
+		return
+	}
 
 	// if Daylitime is enabled retrieve the content
 	if invoice.Dailytime.Enabled {
@@ -189,11 +362,47 @@ func RenderInvoice(password, templatePath string) (invoiceNumber string, err err
 	if err != nil {
 		return
 	}
+	// resolve the sender profile and the customer
+	if err = resolveProfile(&invoice); err != nil {
+		return
+	}
+	c, err := resolveCustomer(&invoice, password)
+	if err != nil {
+		return
+	}
+	if templatePath, err = invoiceTemplatePath(c, templatePath); err != nil {
+		return
+	}
+	if err = invoice.Validate(); err != nil {
+		return
+	}
+	// assign the next number if missing and the numbering is configured
+	if strings.TrimSpace(invoice.Invoice.Number) == "" && config.Govoice.NumberPattern != "" {
+		if invoice.Invoice.Number, err = assignNumber(descriptorPath); err != nil {
+			return
+		}
+		fmt.Println("assigned invoice number", invoice.Invoice.Number)
+	}
+	// check that the number is not already used in the sequence
+	if config.Govoice.NumberPattern != "" {
+		var duplicate string
+		if duplicate, err = duplicateNumber(invoice.Invoice.Series, invoice.Invoice.Number); err != nil {
+			return
+		}
+		if duplicate != "" {
+			fmt.Println("invoice", invoice.Invoice.Number, "has the same sequence number of invoice", duplicate)
+			err = ErrInvoiceNumberDuplicate
+			return
+		}
+	}
 	// set the return invoice number
 	invoiceNumber = invoice.Invoice.Number
 
 	// load template
 	template, err := readInvoiceTemplate(templatePath)
+	if err != nil {
+		return
+	}
 
 	// if Daylitime is enabled retrieve the content
 	if invoice.Dailytime.Enabled {
@@ -204,7 +413,7 @@ func RenderInvoice(password, templatePath string) (invoiceNumber string, err err
 	descrPath, descrExists := config.GetInvoiceJsonPath(invoice.Invoice.Number)
 
 	// add invoice to the index
-	if err = addToSearchIndex(&invoice); err != nil {
+	if err = addToSearchIndex(&invoice, password); err != nil {
 		return
 	}
 
@@ -229,8 +438,15 @@ func RenderInvoice(password, templatePath string) (invoiceNumber string, err err
 	if invoice.Settings.DateInputFormat == "" {
 		invoice.Settings.DateInputFormat = config.Govoice.DateInputFormat
 	}
+	// copy the rounding rules, so the totals do not change with the configuration
+	r := newRounding(&invoice.Settings)
+	invoice.Settings.RoundingMode, invoice.Settings.RoundingScope = r.Mode, r.Scope
+	// and the currency, so it does not change with the base currency
+	invoice.Settings.Currency = currencyOf(invoice.Settings.Currency)
 
-	writeInvoiceDescriptorEncrypted(&invoice, descrPath, password)
+	if err = writeInvoiceDescriptorEncrypted(&invoice, descrPath, password); err != nil {
+		return
+	}
 
 	fmt.Println("encrypted descriptor created at", descrPath)
 	fmt.Println("pdf created at", pdfPath)
@@ -250,7 +466,6 @@ func RestoreInvoice(invoiceNumber, password string) (err error) {
 	// parse de invoice
 	invoice, err := readInvoiceDescriptorEncrypted(descriptorPath, password)
 	if err != nil {
-		err = errors.New("invalid password")
 		return
 	}
 	// dump it on master descriptor
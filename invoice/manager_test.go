@@ -0,0 +1,322 @@
+package invoice
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+func TestGetTaxes(t *testing.T) {
+	reduced, zero := 7.0, 0.0
+	i := Invoice{
+		Settings: InvoiceSettings{
+			ItemsPrice:    10,
+			VatRate:       19,
+			TaxCategories: map[string]float64{"books": 7},
+		},
+		Items: &[]Item{
+			Item{Description: "consulting", Quantity: 10},
+			Item{Description: "book", Quantity: 2, Price: 50, TaxCategory: "books"},
+			Item{Description: "magazine", Quantity: 1, Price: 100, TaxRate: &reduced},
+			Item{Description: "export", Quantity: 1, Price: 30, TaxRate: &zero},
+			Item{Description: "training", Quantity: 2, Price: 25, TaxCategory: "unknown"},
+		},
+	}
+
+	expected := []TaxLine{
+		TaxLine{Rate: 19, Base: Money{15000, ""}, Amount: Money{2850, ""}},
+		TaxLine{Rate: 7, Base: Money{20000, ""}, Amount: Money{1400, ""}},
+		TaxLine{Rate: 0, Base: Money{3000, ""}, Amount: Money{0, ""}},
+	}
+	if taxes := i.GetTaxes(); !reflect.DeepEqual(taxes, expected) {
+		t.Error("expected", expected, "found", taxes)
+	}
+
+	subtotal, total := i.GetTotals()
+	if subtotal.String() != "380.00" {
+		t.Error("expected", "380.00", "found", subtotal)
+	}
+	if total.String() != "422.50" {
+		t.Error("expected", "422.50", "found", total)
+	}
+
+	// no items
+	i.Items = nil
+	if taxes := i.GetTaxes(); len(taxes) != 0 {
+		t.Error("expected", 0, "found", len(taxes))
+	}
+}
+
+func TestGetTotalsDiscounts(t *testing.T) {
+	i := Invoice{
+		Settings: InvoiceSettings{
+			VatRate:       19,
+			TaxCategories: map[string]float64{"books": 7},
+		},
+		Items: &[]Item{
+			Item{Description: "consulting", Quantity: 10, Price: 10, Discount: &Discount{Percent: 10}},
+			Item{Description: "book", Quantity: 1, Price: 100, TaxCategory: "books", Discount: &Discount{Amount: 20}},
+			Item{Description: "gift", Quantity: 1, Price: 5, Discount: &Discount{Amount: 10}},
+		},
+		Discount: &Discount{Percent: 10},
+	}
+
+	items := *i.Items
+	if d := items[0].GetDiscount(&i.Settings); d.String() != "10.00" {
+		t.Error("expected", "10.00", "found", d)
+	}
+	// the discount is never greater than the cost
+	if d := items[2].GetDiscount(&i.Settings); d.String() != "5.00" {
+		t.Error("expected", "5.00", "found", d)
+	}
+	if d := i.GetDiscount(); d.String() != "17.00" {
+		t.Error("expected", "17.00", "found", d)
+	}
+	expected := []TaxLine{
+		TaxLine{Rate: 19, Base: Money{8100, ""}, Amount: Money{1539, ""}},
+		TaxLine{Rate: 7, Base: Money{7200, ""}, Amount: Money{504, ""}},
+	}
+	if taxes := i.GetTaxes(); !reflect.DeepEqual(taxes, expected) {
+		t.Error("expected", expected, "found", taxes)
+	}
+	subtotal, total := i.GetTotals()
+	if subtotal.String() != "153.00" || total.String() != "173.43" {
+		t.Error("expected", "153.00", "173.43", "found", subtotal, total)
+	}
+
+	// a fixed discount split among the rates without losing cents
+	i = Invoice{
+		Settings: InvoiceSettings{VatRate: 19, TaxCategories: map[string]float64{"books": 7}},
+		Items: &[]Item{
+			Item{Quantity: 1, Price: 1},
+			Item{Quantity: 2, Price: 1, TaxCategory: "books"},
+		},
+		Discount: &Discount{Amount: 1},
+	}
+	taxes := i.GetTaxes()
+	if taxes[0].Base.String() != "0.67" || taxes[1].Base.String() != "1.33" {
+		t.Error("expected", "0.67", "1.33", "found", taxes[0].Base, taxes[1].Base)
+	}
+	if subtotal, _ = i.GetTotals(); subtotal.String() != "2.00" {
+		t.Error("expected", "2.00", "found", subtotal)
+	}
+}
+
+func TestCreditInvoice(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	if _, _, err := Setup(tmpWorkspace); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	config.Govoice.NumberPattern = "{YYYY}-{SEQ:4}"
+	config.Govoice.NumberSeries = map[string]string{config.CreditNoteSeries: "CN-"}
+	tplPath, _ := config.GetTemplatePath(config.DefaultTemplateName)
+
+	writeTestDescriptors(t, "password", "2026-0001")
+	p, _ := config.GetInvoiceJsonPath("2026-0001")
+	original, _ := readInvoiceDescriptorEncrypted(p, "password")
+
+	number, err := CreditInvoice("2026-0001", "", "password", tplPath)
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if expected := "CN-" + time.Now().Format("2006") + "-0001"; number != expected {
+		t.Error("expected", expected, "found", number)
+	}
+	if pdfPath, exists := config.GetInvoicePdfPath(number); !exists {
+		t.Error("pdf", pdfPath, "not found")
+	}
+	p, _ = config.GetInvoiceJsonPath(number)
+	credit, err := readInvoiceDescriptorEncrypted(p, "password")
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if credit.Invoice.CreditNoteOf != "2026-0001" || credit.Invoice.Series != config.CreditNoteSeries {
+		t.Error("expected", "2026-0001", config.CreditNoteSeries, "found", credit.Invoice.CreditNoteOf, credit.Invoice.Series)
+	}
+	osub, otot := original.GetTotals()
+	cs, ct := credit.GetTotals()
+	if cs != osub.Neg() || ct != otot.Neg() {
+		t.Error("expected", osub.Neg(), otot.Neg(), "found", cs, ct)
+	}
+	// the credit is recorded in the ledger, the invoice cannot be paid or credited again
+	ledger, err := ReadPaymentLedger("password")
+	if err != nil || ledger.CreditedBy("2026-0001") != number {
+		t.Error("expected", number, "found", ledger.CreditedBy("2026-0001"), err)
+	}
+	if s, err := GetPaymentStatus("2026-0001", "password"); err != nil || s.Status != config.StatusCredited {
+		t.Error("expected", config.StatusCredited, "found", s.Status, err)
+	}
+	if _, err = RecordPayment("2026-0001", 10, time.Now(), "", "password"); !strings.HasPrefix(fmt.Sprint(err), ErrInvoiceCredited.Error()) {
+		t.Error("expected", ErrInvoiceCredited, "found", err)
+	}
+	if _, err = CreditInvoice("2026-0001", "", "password", tplPath); !strings.HasPrefix(fmt.Sprint(err), ErrInvoiceAlreadyCredited.Error()) {
+		t.Error("expected", ErrInvoiceAlreadyCredited, "found", err)
+	}
+
+	// the discounts of the credit note are negative too
+	original.Invoice.Number = "2026-0002"
+	original.Discount = &Discount{Percent: 10, Amount: 5}
+	(*original.Items)[0].Price, (*original.Items)[1].Price = 100, 60
+	(*original.Items)[0].Discount = &Discount{Percent: 5, Amount: 2}
+	p, _ = config.GetInvoiceJsonPath("2026-0002")
+	if err = writeInvoiceDescriptorEncrypted(&original, p, "password"); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	// the number is already used
+	if _, err = CreditInvoice("2026-0002", number, "password", tplPath); err != InvoiceDescriptorExists {
+		t.Error("expected", InvoiceDescriptorExists, "found", err)
+	}
+	discounted, err := CreditInvoice("2026-0002", "", "password", tplPath)
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	p, _ = config.GetInvoiceJsonPath(discounted)
+	if credit, err = readInvoiceDescriptorEncrypted(p, "password"); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	osub, otot = original.GetTotals()
+	cs, ct = credit.GetTotals()
+	if osub.String() != "1118.20" || cs != osub.Neg() || ct != otot.Neg() || credit.GetDiscount() != original.GetDiscount().Neg() {
+		t.Error("expected", osub.Neg(), otot.Neg(), original.GetDiscount().Neg(), "found", cs, ct, credit.GetDiscount())
+	}
+
+	// a credit note cannot be credited
+	if _, err = CreditInvoice(number, "", "password", tplPath); err != ErrCreditNoteOfCreditNote {
+		t.Error("expected", ErrCreditNoteOfCreditNote, "found", err)
+	}
+	// the credit series has a default prefix, the number is required without a pattern
+	config.Govoice.NumberSeries = nil
+	if next, err := NextInvoiceNumber(config.CreditNoteSeries, time.Now()); err != nil || !strings.HasPrefix(next, config.DefaultCreditNotePrefix) {
+		t.Error("expected", config.DefaultCreditNotePrefix, "found", next, err)
+	}
+	writeTestDescriptors(t, "password", "2026-0003")
+	config.Govoice.NumberPattern = ""
+	if _, err = CreditInvoice("2026-0003", "", "password", tplPath); err != ErrCreditNoteNumberRequired {
+		t.Error("expected", ErrCreditNoteNumberRequired, "found", err)
+	}
+	if _, err = CreditInvoice("missing", "", "password", tplPath); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+}
+
+func TestTaxTreatment(t *testing.T) {
+	i := Invoice{
+		From:     Recipient{Country: "Germany", VatNumber: "DE123456789"},
+		To:       Recipient{Country: "Spain", VatNumber: "ESB12345678"},
+		Settings: InvoiceSettings{VatRate: 19, TaxCategories: map[string]float64{"books": 7}},
+		Items: &[]Item{
+			Item{Quantity: 1, Price: 100},
+			Item{Quantity: 1, Price: 50, TaxCategory: "books"},
+		},
+	}
+	tpl := defaultTemplate()
+	if _, total := i.GetTotals(); total.String() != "172.50" {
+		t.Error("expected", "172.50", "found", total)
+	}
+	if note := treatmentNote(&i, &tpl); note != "" {
+		t.Error("expected", "", "found", note)
+	}
+
+	// no vat is charged
+	for _, tt := range []string{config.TaxReverseCharge, config.TaxIntraCommunity, config.TaxExport} {
+		i.Settings.TaxTreatment = tt
+		if err := i.ValidateTaxTreatment(); err != nil {
+			t.Error(tt, "unexpected", err, "as error")
+		}
+		if _, total := i.GetTotals(); total.String() != "150.00" {
+			t.Error(tt, "expected", "150.00", "found", total)
+		}
+		if note := treatmentNote(&i, &tpl); note != defaultTreatmentNotes[tt] {
+			t.Error(tt, "expected", defaultTreatmentNotes[tt], "found", note)
+		}
+	}
+
+	// the vat numbers are required
+	i.Settings.TaxTreatment = config.TaxReverseCharge
+	i.To.VatNumber = ""
+	if err := i.ValidateTaxTreatment(); err != ErrVatNumberRequired {
+		t.Error("expected", ErrVatNumberRequired, "found", err)
+	}
+	// intra community supplies are for customers in other EU countries
+	i.Settings.TaxTreatment = config.TaxIntraCommunity
+	i.To.VatNumber = "DE987654321"
+	if err := i.ValidateTaxTreatment(); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+
+	i.Settings.TaxTreatment = config.TaxExempt
+	if err := i.ValidateTaxTreatment(); err != ErrExemptionReasonRequired {
+		t.Error("expected", ErrExemptionReasonRequired, "found", err)
+	}
+	i.Settings.ExemptionReason = "small business (§ 19 UStG)"
+	tpl.Page.TaxTreatmentNotes[config.TaxExempt] = "Steuerfrei"
+	if note := treatmentNote(&i, &tpl); note != "Steuerfrei: small business (§ 19 UStG)" {
+		t.Error("expected", "Steuerfrei: small business (§ 19 UStG)", "found", note)
+	}
+
+	i.Settings.TaxTreatment = "unknown"
+	if err := i.ValidateTaxTreatment(); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+}
+
+func TestGetTotalsAdditionalTaxes(t *testing.T) {
+	i := Invoice{
+		Settings: InvoiceSettings{
+			VatRate: 22,
+			AdditionalTaxes: []AdditionalTax{
+				{Name: "social_security", Rate: 4},
+				{Name: "withholding", Rate: 20, Withheld: true},
+				{Name: "stamp", Rate: 1, Base: config.AdditionalTaxBaseGross},
+			},
+		},
+		Items: &[]Item{Item{Quantity: 1, Price: 1000.05}},
+	}
+	expected := []AdditionalTaxLine{
+		{Name: "social_security", Rate: 4, Base: Money{100005, ""}, Amount: Money{4000, ""}},
+		{Name: "withholding", Rate: 20, Base: Money{100005, ""}, Amount: Money{-20001, ""}},
+		{Name: "stamp", Rate: 1, Base: Money{122006, ""}, Amount: Money{1220, ""}},
+	}
+	if lines := i.GetAdditionalTaxes(); !reflect.DeepEqual(lines, expected) {
+		t.Error("expected", expected, "found", lines)
+	}
+	// 1000.05 + 220.01 vat + 40.00 - 200.01 + 12.20
+	subtotal, total := i.GetTotals()
+	if subtotal.String() != "1000.05" || total.String() != "1072.25" {
+		t.Error("expected", "1000.05", "1072.25", "found", subtotal, total)
+	}
+	if err := i.Validate(); err != nil {
+		t.Error("unexpected", err, "as error")
+	}
+
+	invalid := []AdditionalTax{{Rate: 4}, {Name: "negative", Rate: -1}, {Name: "base", Rate: 1, Base: "total"}}
+	for _, at := range invalid {
+		i.Settings.AdditionalTaxes = []AdditionalTax{at}
+		if err := i.Validate(); err == nil {
+			t.Error("additional tax", at, "should be invalid")
+		}
+	}
+}
+
+func TestPreviewInvoiceTemplate(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	if _, _, err := Setup(tmpWorkspace); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	// a missing template is not replaced by an empty one
+	if _, err := PreviewInvoice("", path.Join(tmpHome, "missing.toml")); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+	tplPath, _ := config.GetTemplatePath(config.DefaultTemplateName)
+	if _, err := PreviewInvoice("", tplPath); err != nil {
+		t.Error("unexpected", err, "as error")
+	}
+}
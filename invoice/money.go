@@ -0,0 +1,166 @@
+package invoice
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+// Money is an amount in the minor units of a currency (ex. cents)
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency,omitempty"`
+}
+
+// defaultDecimals is the number of decimals of the currencies missing in currencyDecimals
+const defaultDecimals = 2
+
+// currencyDecimals are the ISO 4217 currencies whose minor unit is not the cent
+var currencyDecimals = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "HUF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// CurrencyDecimals returns the number of decimals of the amounts of a currency,
+// empty is the base currency
+func CurrencyDecimals(currency string) int {
+	if d, ok := currencyDecimals[currencyOf(currency)]; ok {
+		return d
+	}
+	return defaultDecimals
+}
+
+// minorUnits returns the number of minor units in a major unit of a currency (ex. 100 cents)
+func minorUnits(currency string) int64 {
+	units := int64(1)
+	for d := CurrencyDecimals(currency); d > 0; d-- {
+		units *= 10
+	}
+	return units
+}
+
+// Add returns the sum of two amounts, in the currency of the first one
+// or of the second one if the first has no currency (ex. a zero sum)
+func (m Money) Add(o Money) Money {
+	return Money{Amount: m.Amount + o.Amount, Currency: sumCurrency(m, o)}
+}
+
+// Sub returns the difference of two amounts
+func (m Money) Sub(o Money) Money {
+	return Money{Amount: m.Amount - o.Amount, Currency: sumCurrency(m, o)}
+}
+
+// sumCurrency returns the currency of the sum of two amounts
+func sumCurrency(m, o Money) string {
+	if m.Currency == "" {
+		return o.Currency
+	}
+	return m.Currency
+}
+
+// Neg returns the amount with the opposite sign
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// IsZero tells if the amount is zero
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Float64 returns the amount in major units, for formatting and indexing only
+func (m Money) Float64() float64 {
+	return float64(m.Amount) / float64(minorUnits(m.Currency))
+}
+
+// Rat returns the exact amount in major units
+func (m Money) Rat() *big.Rat {
+	return big.NewRat(m.Amount, minorUnits(m.Currency))
+}
+
+// String returns the amount in major units with the decimals of the currency
+func (m Money) String() string {
+	sign, a := "", m.Amount
+	if a < 0 {
+		sign, a = "-", -a
+	}
+	units, decimals := minorUnits(m.Currency), CurrencyDecimals(m.Currency)
+	if decimals == 0 {
+		return fmt.Sprintf("%s%d", sign, a)
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, a/units, decimals, a%units)
+}
+
+// rounding describes how the amounts are rounded to the minor units
+type rounding struct {
+	// Mode is how the halves are rounded (half up or half even)
+	Mode string
+	// Scope is when the amounts are rounded (each line or only the totals)
+	Scope string
+	// Currency is the currency of the amounts, its minor units are the precision of the lines
+	Currency string
+}
+
+// newRounding returns the rounding rules of the invoice settings,
+// the rules of the configuration are used for the missing ones
+func newRounding(s *InvoiceSettings) rounding {
+	r := rounding{Mode: s.RoundingMode, Scope: s.RoundingScope, Currency: s.Currency}
+	if r.Mode == "" {
+		r.Mode = config.Govoice.RoundingMode
+	}
+	if r.Scope == "" {
+		r.Scope = config.Govoice.RoundingScope
+	}
+	if r.Mode != config.RoundingHalfEven {
+		r.Mode = config.RoundingHalfUp
+	}
+	if r.Scope != config.RoundingScopeTotal {
+		r.Scope = config.RoundingScopeLine
+	}
+	return r
+}
+
+// round rounds an amount in major units to the minor units of the currency
+func (r rounding) round(amount *big.Rat, currency string) Money {
+	// amount in minor units, as num / den
+	v := new(big.Rat).Mul(amount, big.NewRat(minorUnits(currency), 1))
+	num, den := new(big.Int).Set(v.Num()), v.Denom()
+	neg := num.Sign() < 0
+	num.Abs(num)
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	// compare twice the remainder with the denominator to find the half
+	switch c := new(big.Int).Lsh(rem, 1).Cmp(den); {
+	case c > 0:
+		q.Add(q, big.NewInt(1))
+	case c == 0 && (r.Mode == config.RoundingHalfUp || q.Bit(0) == 1):
+		q.Add(q, big.NewInt(1))
+	}
+	if neg {
+		q.Neg(q)
+	}
+	return Money{Amount: q.Int64(), Currency: currency}
+}
+
+// line rounds the amount of a line, the amount is not rounded
+// if the rounding applies only to the totals
+func (r rounding) line(amount *big.Rat) *big.Rat {
+	if r.Scope == config.RoundingScopeTotal {
+		return amount
+	}
+	return r.round(amount, r.Currency).Rat()
+}
+
+// decimalRat converts a decimal number to an exact rational,
+// using the shortest representation of the number (ex. 4.1 is 41/10)
+func decimalRat(f float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	return r
+}
+
+// moneyFromFloat converts an amount in major units to money (ex. an amount from the index)
+func moneyFromFloat(f float64, currency string) Money {
+	return rounding{Mode: config.RoundingHalfUp}.round(decimalRat(f), currency)
+}
@@ -0,0 +1,116 @@
+package invoice
+
+import (
+	"math/big"
+	"testing"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+func TestRounding(t *testing.T) {
+	tests := []struct {
+		amount   string
+		mode     string
+		expected string
+	}{
+		{"0.125", config.RoundingHalfUp, "0.13"},
+		{"0.125", config.RoundingHalfEven, "0.12"},
+		{"0.135", config.RoundingHalfEven, "0.14"},
+		{"-0.125", config.RoundingHalfUp, "-0.13"},
+		{"-0.125", config.RoundingHalfEven, "-0.12"},
+		{"83.64", config.RoundingHalfUp, "83.64"},
+		{"1.005", config.RoundingHalfUp, "1.01"},
+		{"2.3449", config.RoundingHalfUp, "2.34"},
+		{"1/3", config.RoundingHalfUp, "0.33"},
+	}
+	for _, tt := range tests {
+		a, _ := new(big.Rat).SetString(tt.amount)
+		if m := (rounding{Mode: tt.mode}).round(a, "€"); m.String() != tt.expected {
+			t.Error(tt.amount, tt.mode, "expected", tt.expected, "found", m)
+		}
+	}
+}
+
+func TestCurrencyMinorUnits(t *testing.T) {
+	config.Govoice = config.MainConfig{}
+	tests := []struct {
+		amount   string
+		currency string
+		expected string
+		float    float64
+	}{
+		{"1234.5", "JPY", "1235", 1235},
+		{"-1234.5", "jpy", "-1235", -1235},
+		{"99.4", "HUF", "99", 99},
+		{"1.2345", "KWD", "1.235", 1.235},
+		{"1.2345", "EUR", "1.23", 1.23},
+		{"1.2345", "", "1.23", 1.23},
+	}
+	for _, tt := range tests {
+		a, _ := new(big.Rat).SetString(tt.amount)
+		m := (rounding{Mode: config.RoundingHalfUp}).round(a, tt.currency)
+		if m.String() != tt.expected || m.Float64() != tt.float || m.Rat().FloatString(3) != decimalRat(tt.float).FloatString(3) {
+			t.Error(tt.amount, tt.currency, "expected", tt.expected, "found", m, m.Float64())
+		}
+	}
+
+	// the lines are rounded to yen: 3 x 333.3 is 999
+	i := Invoice{
+		Settings: InvoiceSettings{ItemsPrice: 333.3, Currency: "JPY"},
+		Items:    &[]Item{Item{Quantity: 1}, Item{Quantity: 1}, Item{Quantity: 1}},
+	}
+	if subtotal, _ := i.GetTotals(); subtotal.String() != "999" || subtotal.Amount != 999 {
+		t.Error("expected", "999", "found", subtotal)
+	}
+	// the base currency is used for the amounts without currency
+	config.Govoice.BaseCurrency = "JPY"
+	if m := moneyFromFloat(12.5, ""); m.String() != "13" {
+		t.Error("expected", "13", "found", m)
+	}
+	config.Govoice = config.MainConfig{}
+}
+
+func TestGetTotalsRounding(t *testing.T) {
+	config.Govoice = config.MainConfig{}
+	// 4.1 x 20.4 is 83.63999999999999 with float64
+	i := Invoice{
+		Settings: InvoiceSettings{VatRate: 19},
+		Items:    &[]Item{Item{Description: "a", Quantity: 4.1, Price: 20.4}},
+	}
+	subtotal, total := i.GetTotals()
+	if subtotal.String() != "83.64" || total.String() != "99.53" {
+		t.Error("expected", "83.64", "99.53", "found", subtotal, total)
+	}
+
+	// three lines of 0.333: rounded per line or only in the total
+	i = Invoice{
+		Settings: InvoiceSettings{ItemsPrice: 0.333},
+		Items:    &[]Item{Item{Quantity: 1}, Item{Quantity: 1}, Item{Quantity: 1}},
+	}
+	if subtotal, _ = i.GetTotals(); subtotal.String() != "0.99" {
+		t.Error("expected", "0.99", "found", subtotal)
+	}
+	config.Govoice.RoundingScope = config.RoundingScopeTotal
+	if subtotal, _ = i.GetTotals(); subtotal.String() != "1.00" {
+		t.Error("expected", "1.00", "found", subtotal)
+	}
+	// the invoice settings have precedence over the configuration
+	i.Settings.RoundingScope = config.RoundingScopeLine
+	if subtotal, _ = i.GetTotals(); subtotal.String() != "0.99" {
+		t.Error("expected", "0.99", "found", subtotal)
+	}
+
+	// tax of 0.125, half up or half even
+	i = Invoice{
+		Settings: InvoiceSettings{VatRate: 12.5, ItemsPrice: 1},
+		Items:    &[]Item{Item{Quantity: 1}},
+	}
+	if _, total = i.GetTotals(); total.String() != "1.13" {
+		t.Error("expected", "1.13", "found", total)
+	}
+	i.Settings.RoundingMode = config.RoundingHalfEven
+	if _, total = i.GetTotals(); total.String() != "1.12" {
+		t.Error("expected", "1.12", "found", total)
+	}
+	config.Govoice = config.MainConfig{}
+}
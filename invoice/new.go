@@ -0,0 +1,158 @@
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+// Errors
+var ErrMasterNotRendered = errors.New("the master descriptor has not been rendered yet, use --force to overwrite it")
+
+// lastDigits matches the last group of digits of an invoice number
+var lastDigits = regexp.MustCompile(`(\d+)(\D*)$`)
+
+// NewInvoiceOptions are the options to scaffold the next invoice in the master descriptor
+type NewInvoiceOptions struct {
+	// From is the number of the invoice to start from, the master descriptor when empty
+	From string
+	// Customer is the id of the customer of the new invoice, the customer of the invoice when empty
+	Customer string
+	// KeepItems copies the items and the discount of the invoice, they are emptied otherwise
+	KeepItems bool
+	// Force overwrites a master descriptor not rendered
+	Force bool
+}
+
+// MasterRendered tells if the invoice of the master descriptor has already been rendered,
+// that is if the workspace has a descriptor with the same number
+func MasterRendered() (rendered bool, err error) {
+	master, err := ReadMasterDescriptor()
+	if err != nil {
+		return
+	}
+	_, rendered = config.GetInvoiceJsonPath(strings.TrimSpace(master.Invoice.Number))
+	return
+}
+
+// NewInvoice writes the next invoice in the master descriptor, starting from the master descriptor
+// or from an invoice of the workspace: the number is the next one of the sequence, the date is today
+// and the due date is computed from the defaultInvoiceNet days of the configuration (or the payment terms
+// of the customer). The password is required only to start from an invoice or to set a customer
+func NewInvoice(opts NewInvoiceOptions, password string) (invoice Invoice, err error) {
+	if !opts.Force {
+		var rendered bool
+		if rendered, err = MasterRendered(); err == nil && !rendered {
+			err = ErrMasterNotRendered
+		}
+		if err != nil {
+			return
+		}
+	}
+	if opts.From != "" {
+		invoice, err = readArchivedInvoice(opts.From, password)
+	} else {
+		invoice, err = ReadMasterDescriptor()
+	}
+	if err != nil {
+		return
+	}
+	if err = nextInvoice(&invoice, time.Now(), opts.KeepItems); err != nil {
+		return
+	}
+	if opts.Customer != "" {
+		invoice.Customer = opts.Customer
+	}
+	// the payment terms of the customer replace the default due date
+	due := invoice.Invoice.Due
+	invoice.Invoice.Due = ""
+	if _, err = resolveCustomer(&invoice, password); err != nil {
+		return
+	}
+	if invoice.Invoice.Due == "" {
+		invoice.Invoice.Due = due
+	}
+	masterPath, _ := config.GetMasterPath()
+	err = writeJsonToFile(masterPath, invoice)
+	return
+}
+
+// nextInvoice turns an invoice in the next one issued at date: the number, the dates and the
+// credit note reference are replaced, the items are emptied unless kept
+func nextInvoice(i *Invoice, date time.Time, keepItems bool) (err error) {
+	format := i.Settings.DateInputFormat
+	if format == "" {
+		format = config.Govoice.DateInputFormat
+	}
+	layout := dateFormatToLayout(format)
+	i.Invoice.Date = date.Format(layout)
+	i.Invoice.Due = date.AddDate(0, 0, config.Govoice.DefaultInvoiceNet).Format(layout)
+	i.Invoice.CreditNoteOf = ""
+	if i.Invoice.Series == config.CreditNoteSeries {
+		i.Invoice.Series = ""
+	}
+	// the next number of the sequence, or the number after the highest one of the workspace without a pattern
+	if config.Govoice.NumberPattern != "" {
+		i.Invoice.Number, err = NextInvoiceNumber(i.Invoice.Series, date)
+	} else {
+		i.Invoice.Number, err = nextWorkspaceNumber(i.Invoice.Number)
+	}
+	if !keepItems {
+		i.Items = &[]Item{}
+		i.Discount = nil
+	}
+	return
+}
+
+// nextWorkspaceNumber increments the highest number of the workspace that differs from an invoice
+// number only in the last group of digits (ex. 2026-0012 -> 2026-0015 when 2026-0014 exists)
+func nextWorkspaceNumber(number string) (next string, err error) {
+	numbers, err := workspaceNumbers()
+	if err != nil {
+		return
+	}
+	prefix, last, suffix, ok := splitNumber(number)
+	if !ok {
+		return
+	}
+	for _, n := range numbers {
+		if p, seq, s, ok := splitNumber(n); ok && p == prefix && s == suffix && seq > last {
+			number, last = n, seq
+		}
+	}
+	next = incrementNumber(number)
+	return
+}
+
+// splitNumber splits an invoice number around its last group of digits
+func splitNumber(number string) (prefix string, seq int, suffix string, ok bool) {
+	m := lastDigits.FindStringSubmatchIndex(number)
+	if m == nil {
+		return
+	}
+	seq, err := strconv.Atoi(number[m[2]:m[3]])
+	if err != nil {
+		return
+	}
+	return number[:m[2]], seq, number[m[3]:], true
+}
+
+// incrementNumber increments the last group of digits of an invoice number keeping its width,
+// (ex. 2026-0012 -> 2026-0013), empty if the number has no digits
+func incrementNumber(number string) string {
+	m := lastDigits.FindStringSubmatchIndex(number)
+	if m == nil {
+		return ""
+	}
+	digits := number[m[2]:m[3]]
+	n, err := strconv.Atoi(digits)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s%0*d%s", number[:m[2]], len(digits), n+1, number[m[3]:])
+}
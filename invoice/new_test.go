@@ -0,0 +1,102 @@
+package invoice
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+func TestIncrementNumber(t *testing.T) {
+	numbers := map[string]string{
+		"0000000":     "0000001",
+		"2026-0012":   "2026-0013",
+		"INV-99":      "INV-100",
+		"A12-B07/x":   "A12-B08/x",
+		"no digits":   "",
+		"":            "",
+		"2026-0999-A": "2026-1000-A",
+	}
+	for n, expected := range numbers {
+		if found := incrementNumber(n); found != expected {
+			t.Error("expected", expected, "found", found)
+		}
+	}
+}
+
+func TestNewInvoice(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	if _, _, err := Setup(tmpWorkspace); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+
+	// the master of the setup has not been rendered
+	if _, err := NewInvoice(NewInvoiceOptions{}, ""); err != ErrMasterNotRendered {
+		t.Error("expected", ErrMasterNotRendered, "found", err)
+	}
+	i, err := NewInvoice(NewInvoiceOptions{Force: true}, "")
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	today := time.Now()
+	if i.Invoice.Number != "0000001" || i.Invoice.Date != today.Format("02.01.2006") || i.Invoice.Due != today.AddDate(0, 0, 30).Format("02.01.2006") {
+		t.Error("unexpected invoice data", i.Invoice)
+	}
+	if len(*i.Items) != 0 || i.To != masterInvoice().To {
+		t.Error("unexpected invoice", i.To, i.Items)
+	}
+	master, _ := ReadMasterDescriptor()
+	if master.Invoice.Number != "0000001" {
+		t.Error("expected", "0000001", "found", master.Invoice.Number)
+	}
+
+	// from a rendered invoice, with the numbering
+	writeTestDescriptors(t, "password", "2026-0001", "2026-0002")
+	config.Govoice.NumberPattern = "{YYYY}-{SEQ:4}"
+	config.Govoice.DefaultInvoiceNet = 10
+	if _, err = NewInvoice(NewInvoiceOptions{From: "2026-0002"}, "password"); err != ErrMasterNotRendered {
+		t.Error("expected", ErrMasterNotRendered, "found", err)
+	}
+	i, err = NewInvoice(NewInvoiceOptions{From: "2026-0002", KeepItems: true, Force: true}, "password")
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	// the sequence continues without the yearly reset
+	expected := today.Format("2006") + "-0003"
+	if i.Invoice.Number != expected || i.Invoice.Due != today.AddDate(0, 0, 10).Format("02.01.2006") || len(*i.Items) == 0 {
+		t.Error("expected", expected, "found", i.Invoice.Number, i.Invoice.Due, len(*i.Items))
+	}
+
+	// the master is now the rendered invoice
+	master.Invoice.Number = "2026-0001"
+	masterPath, _ := config.GetMasterPath()
+	writeJsonToFile(masterPath, master)
+	if rendered, err := MasterRendered(); err != nil || !rendered {
+		t.Error("expected", true, "found", rendered, err)
+	}
+	if _, err = NewInvoice(NewInvoiceOptions{}, ""); err != nil {
+		t.Error("unexpected", err, "as error")
+	}
+	if _, err = NewInvoice(NewInvoiceOptions{Customer: "missing", Force: true}, "password"); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+
+	// without the numbering the number follows the highest one of the workspace
+	config.Govoice.NumberPattern = ""
+	if i, err = NewInvoice(NewInvoiceOptions{From: "2026-0001", Force: true}, "password"); err != nil || i.Invoice.Number != "2026-0003" {
+		t.Error("expected", "2026-0003", "found", i.Invoice.Number, err)
+	}
+
+	// the due date after the payment terms of the customer
+	r := CustomerRegistry{}
+	r.Add(Customer{Recipient: Recipient{Name: "ACME GmbH"}, PaymentTerms: 20})
+	if err = WriteCustomerRegistry(&r, "password"); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	i, err = NewInvoice(NewInvoiceOptions{Customer: "acme-gmbh", Force: true}, "password")
+	if expected := today.AddDate(0, 0, 20).Format("02.01.2006"); err != nil || i.Invoice.Due != expected {
+		t.Error("expected", expected, "found", i.Invoice.Due, err)
+	}
+}
@@ -0,0 +1,353 @@
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+// Errors
+var (
+	ErrNumberingNotConfigured = errors.New("invoice numbering not configured, set numberPattern in the configuration")
+	ErrInvoiceNumberDuplicate = errors.New("invoice number already used in the sequence")
+)
+
+// the tokens of a number pattern:
+// {YYYY} year, {YY} year (2 digits), {MM} month, {SERIES} series prefix,
+// {SEQ} or {SEQ:n} sequence, zero padded to n digits
+var patternToken = regexp.MustCompile(`\{(YYYY|YY|MM|SERIES|SEQ(:[1-9])?)\}`)
+
+// numberPattern is a number pattern compiled for a series
+type numberPattern struct {
+	series  string
+	prefix  string
+	pattern string
+	re      *regexp.Regexp
+	hasYear bool
+}
+
+// sequenceKey identifies a sequence of numbers, the year is 0
+// when the sequence is not reset every year
+type sequenceKey struct {
+	Series string
+	Year   int
+}
+
+// parsedNumber is an invoice number matching a pattern
+type parsedNumber struct {
+	Number string
+	Key    sequenceKey
+	Seq    int
+}
+
+// NumberingGap is a range of numbers missing from a sequence
+type NumberingGap struct {
+	Series string
+	Year   int
+	From   int
+	To     int
+}
+
+// NumberingReport lists the problems found in the invoice numbers of the workspace
+type NumberingReport struct {
+	// Checked is the number of invoices matching the pattern
+	Checked int
+	// Gaps are the ranges of missing numbers
+	Gaps []NumberingGap
+	// Duplicates are the groups of numbers with the same position in a sequence
+	Duplicates [][]string
+}
+
+// Ok tells if no gaps and no duplicates have been found
+func (r *NumberingReport) Ok() bool {
+	return len(r.Gaps) == 0 && len(r.Duplicates) == 0
+}
+
+// compileNumberPattern compiles the number pattern in the configuration for a series
+func compileNumberPattern(series string) (np numberPattern, err error) {
+	pattern := strings.TrimSpace(config.Govoice.NumberPattern)
+	if len(pattern) == 0 {
+		err = ErrNumberingNotConfigured
+		return
+	}
+	if strings.ContainsAny(pattern, `/\`) {
+		err = fmt.Errorf("invalid number pattern '%s': the number is used as file name", pattern)
+		return
+	}
+	if len(series) == 0 {
+		series = config.DefaultSeries
+	}
+	prefix, exists := config.Govoice.NumberSeries[series]
+	if !exists && series == config.CreditNoteSeries {
+		prefix, exists = config.DefaultCreditNotePrefix, true
+	}
+	if !exists && series != config.DefaultSeries {
+		err = fmt.Errorf("unknown series '%s'", series)
+		return
+	}
+	// the prefix goes in front if the pattern has no place for it
+	if !strings.Contains(pattern, "{SERIES}") {
+		pattern = "{SERIES}" + pattern
+	}
+	np = numberPattern{series: series, prefix: prefix, pattern: pattern}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	seqs, last := 0, 0
+	for _, loc := range patternToken.FindAllStringSubmatchIndex(pattern, -1) {
+		expr.WriteString(regexp.QuoteMeta(pattern[last:loc[0]]))
+		last = loc[1]
+		switch token := pattern[loc[2]:loc[3]]; {
+		case token == "YYYY":
+			expr.WriteString(`(?P<year>\d{4})`)
+			np.hasYear = true
+		case token == "YY":
+			expr.WriteString(`(?P<yy>\d{2})`)
+			np.hasYear = true
+		case token == "MM":
+			expr.WriteString(`\d{2}`)
+		case token == "SERIES":
+			expr.WriteString(regexp.QuoteMeta(prefix))
+		default:
+			expr.WriteString(`(?P<seq>\d+)`)
+			seqs++
+		}
+	}
+	expr.WriteString(regexp.QuoteMeta(pattern[last:]))
+	expr.WriteString("$")
+
+	if seqs != 1 {
+		err = fmt.Errorf("invalid number pattern '%s': it must contain exactly one {SEQ}", pattern)
+		return
+	}
+	if config.Govoice.NumberYearlyReset && !np.hasYear {
+		err = fmt.Errorf("invalid number pattern '%s': the yearly reset requires {YYYY} or {YY}", pattern)
+		return
+	}
+	np.re, err = regexp.Compile(expr.String())
+	return
+}
+
+// yearly tells if the sequence restarts every year
+func (np *numberPattern) yearly() bool {
+	return config.Govoice.NumberYearlyReset && np.hasYear
+}
+
+// format builds the number for a position in the sequence and a date
+func (np *numberPattern) format(seq int, date time.Time) string {
+	return patternToken.ReplaceAllStringFunc(np.pattern, func(token string) string {
+		switch token {
+		case "{YYYY}":
+			return fmt.Sprintf("%04d", date.Year())
+		case "{YY}":
+			return fmt.Sprintf("%02d", date.Year()%100)
+		case "{MM}":
+			return fmt.Sprintf("%02d", int(date.Month()))
+		case "{SERIES}":
+			return np.prefix
+		case "{SEQ}":
+			return strconv.Itoa(seq)
+		}
+		// {SEQ:n}
+		return fmt.Sprintf("%0*d", int(token[5]-'0'), seq)
+	})
+}
+
+// parse reads an invoice number, returns false if the number does not match the pattern
+func (np *numberPattern) parse(number string) (p parsedNumber, ok bool) {
+	m := np.re.FindStringSubmatch(number)
+	if m == nil {
+		return
+	}
+	p = parsedNumber{Number: number, Key: sequenceKey{Series: np.series}}
+	for i, name := range np.re.SubexpNames() {
+		v, _ := strconv.Atoi(m[i])
+		switch name {
+		case "seq":
+			p.Seq = v
+		case "year":
+			p.Key.Year = v
+		case "yy":
+			p.Key.Year = 2000 + v
+		}
+	}
+	if !np.yearly() {
+		p.Key.Year = 0
+	}
+	return p, true
+}
+
+// workspaceNumbers returns the invoice numbers of the encrypted descriptors in the workspace
+func workspaceNumbers() (numbers []string, err error) {
+	names, err := encryptedDescriptors()
+	if err != nil {
+		return
+	}
+	for _, n := range names {
+		numbers = append(numbers, strings.TrimSuffix(n, "."+config.ExtJsonEncripted))
+	}
+	return
+}
+
+// NextInvoiceNumber returns the next invoice number of a series for an invoice issued at date,
+// the sequence continues from the highest number found in the workspace
+func NextInvoiceNumber(series string, date time.Time) (number string, err error) {
+	np, err := compileNumberPattern(series)
+	if err != nil {
+		return
+	}
+	numbers, err := workspaceNumbers()
+	if err != nil {
+		return
+	}
+	key := sequenceKey{Series: np.series}
+	if np.yearly() {
+		key.Year = date.Year()
+	}
+	last := 0
+	for _, n := range numbers {
+		if p, ok := np.parse(n); ok && p.Key == key && p.Seq > last {
+			last = p.Seq
+		}
+	}
+	number = np.format(last+1, date)
+	return
+}
+
+// AssignMasterNumber sets the next invoice number in the master descriptor,
+// the number is computed using the series and the date of the master descriptor
+func AssignMasterNumber() (number string, err error) {
+	masterPath, exists := config.GetMasterPath()
+	if !exists {
+		err = errors.New("master descriptor not found")
+		return
+	}
+	return assignNumber(masterPath)
+}
+
+// assignNumber sets the next invoice number in a master descriptor, the numbering
+// is the one of the workspace in use, that may be the one of a sender profile
+func assignNumber(masterPath string) (number string, err error) {
+	invoice, err := readInvoiceDescriptor(masterPath)
+	if err != nil {
+		return
+	}
+	if number, err = NextInvoiceNumber(invoice.Invoice.Series, invoiceDate(&invoice)); err != nil {
+		return
+	}
+	invoice.Invoice.Number = number
+	err = writeJsonToFile(masterPath, invoice)
+	return
+}
+
+// duplicateNumber returns the number of another invoice in the workspace
+// with the same position in the sequence, or an empty string if there is none
+func duplicateNumber(series, number string) (duplicate string, err error) {
+	np, err := compileNumberPattern(series)
+	if err != nil {
+		return
+	}
+	p, ok := np.parse(number)
+	if !ok {
+		return
+	}
+	numbers, err := workspaceNumbers()
+	if err != nil {
+		return
+	}
+	for _, n := range numbers {
+		if o, ok := np.parse(n); ok && n != number && o.Key == p.Key && o.Seq == p.Seq {
+			duplicate = n
+			return
+		}
+	}
+	return
+}
+
+// CheckNumbering scans the invoice numbers in the workspace, for every series
+// reports the numbers missing from the sequences and the duplicated ones.
+// Only the numbers matching the number pattern are checked
+func CheckNumbering() (report NumberingReport, err error) {
+	numbers, err := workspaceNumbers()
+	if err != nil {
+		return
+	}
+	series := []string{config.DefaultSeries}
+	for s := range config.Govoice.NumberSeries {
+		if s != config.DefaultSeries {
+			series = append(series, s)
+		}
+	}
+	sort.Strings(series[1:])
+
+	for _, s := range series {
+		var np numberPattern
+		if np, err = compileNumberPattern(s); err != nil {
+			return
+		}
+		// group the numbers by sequence and position
+		sequences := make(map[sequenceKey]map[int][]string)
+		var keys []sequenceKey
+		for _, n := range numbers {
+			p, ok := np.parse(n)
+			if !ok {
+				continue
+			}
+			if _, exists := sequences[p.Key]; !exists {
+				sequences[p.Key] = make(map[int][]string)
+				keys = append(keys, p.Key)
+			}
+			sequences[p.Key][p.Seq] = append(sequences[p.Key][p.Seq], n)
+			report.Checked++
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Year < keys[j].Year })
+
+		for _, k := range keys {
+			seq := sequences[k]
+			last := 0
+			for n := range seq {
+				if n > last {
+					last = n
+				}
+			}
+			for n := 1; n <= last; n++ {
+				if dups, exists := seq[n]; !exists {
+					// extend the previous gap if contiguous
+					if g := len(report.Gaps) - 1; g >= 0 && report.Gaps[g].Series == k.Series && report.Gaps[g].Year == k.Year && report.Gaps[g].To == n-1 {
+						report.Gaps[g].To = n
+					} else {
+						report.Gaps = append(report.Gaps, NumberingGap{Series: k.Series, Year: k.Year, From: n, To: n})
+					}
+				} else if len(dups) > 1 {
+					sort.Strings(dups)
+					report.Duplicates = append(report.Duplicates, dups)
+				}
+			}
+		}
+	}
+	return
+}
+
+// invoiceDate returns the date of the invoice, or the current date
+// if the date is missing or does not match the date format
+func invoiceDate(i *Invoice) time.Time {
+	if d, err := parseInvoiceDate(i); err == nil {
+		return d
+	}
+	return time.Now()
+}
+
+// parseInvoiceDate parses the date of the invoice with its date format
+func parseInvoiceDate(i *Invoice) (time.Time, error) {
+	format := i.Settings.DateInputFormat
+	if len(format) == 0 {
+		format = config.Govoice.DateInputFormat
+	}
+	return time.Parse(dateFormatToLayout(format), i.Invoice.Date)
+}
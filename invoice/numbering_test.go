@@ -0,0 +1,129 @@
+package invoice
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+func touchDescriptors(t *testing.T, numbers ...string) {
+	os.MkdirAll(config.Govoice.Workspace, 0770)
+	for _, n := range numbers {
+		p, _ := config.GetInvoiceJsonPath(n)
+		if err := ioutil.WriteFile(p, []byte{}, 0660); err != nil {
+			t.Fatal("unexpected", err, "as error")
+		}
+	}
+}
+
+func TestNextInvoiceNumber(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	config.Govoice = config.MainConfig{Workspace: tmpWorkspace, MasterDescriptor: "_master"}
+
+	d2026 := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	d2027 := time.Date(2027, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	touchDescriptors(t)
+	if _, err := NextInvoiceNumber("", d2026); err != ErrNumberingNotConfigured {
+		t.Error("expected", ErrNumberingNotConfigured, "found", err)
+	}
+
+	config.Govoice.NumberPattern = "{YYYY}-{SEQ:4}"
+	config.Govoice.NumberYearlyReset = true
+	config.Govoice.NumberSeries = map[string]string{"credit": "CN-"}
+
+	tests := []struct {
+		series   string
+		date     time.Time
+		existing []string
+		expected string
+	}{
+		{"", d2026, nil, "2026-0001"},
+		{"", d2026, []string{"2026-0001", "2026-0002", "0001", "PREVIEW"}, "2026-0003"},
+		{"default", d2026, []string{"2026-0009", "2025-0020"}, "2026-0010"},
+		{"", d2027, []string{"2026-0009"}, "2027-0001"},
+		{"credit", d2026, []string{"2026-0010", "CN-2026-0001"}, "CN-2026-0002"},
+	}
+	for _, tt := range tests {
+		touchDescriptors(t, tt.existing...)
+		n, err := NextInvoiceNumber(tt.series, tt.date)
+		if err != nil {
+			t.Error("unexpected", err, "as error")
+		}
+		if n != tt.expected {
+			t.Error("expected", tt.expected, "found", n)
+		}
+	}
+
+	// without yearly reset the sequence continues
+	config.Govoice.NumberYearlyReset = false
+	if n, _ := NextInvoiceNumber("", d2027); n != "2027-0021" {
+		t.Error("expected", "2027-0021", "found", n)
+	}
+
+	if _, err := NextInvoiceNumber("unknown", d2026); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+
+	invalid := []string{"{YYYY}-", "{SEQ}-{SEQ}", "{YYYY}/{SEQ}"}
+	for _, p := range invalid {
+		config.Govoice.NumberPattern = p
+		if _, err := NextInvoiceNumber("", d2026); err == nil {
+			t.Error("pattern", p, "should be invalid")
+		}
+	}
+	// the yearly reset needs the year in the number
+	config.Govoice.NumberPattern = "{SEQ:5}"
+	config.Govoice.NumberYearlyReset = true
+	if _, err := NextInvoiceNumber("", d2026); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+}
+
+func TestCheckNumbering(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	config.Govoice = config.MainConfig{
+		Workspace:         tmpWorkspace,
+		MasterDescriptor:  "_master",
+		NumberPattern:     "{SERIES}{YY}{MM}{SEQ:3}",
+		NumberYearlyReset: true,
+		NumberSeries:      map[string]string{"credit": "CN"},
+	}
+
+	touchDescriptors(t, "2601001", "2602002", "2605005", "2605006", "2701001", "2703003", "2703003x", "CN2601001", "CN2601002", "CN260200002")
+
+	r, err := CheckNumbering()
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if r.Checked != 9 {
+		t.Error("expected", 9, "found", r.Checked)
+	}
+	gaps := []NumberingGap{
+		{Series: "default", Year: 2026, From: 3, To: 4},
+		{Series: "default", Year: 2027, From: 2, To: 2},
+	}
+	if !reflect.DeepEqual(r.Gaps, gaps) {
+		t.Error("expected", gaps, "found", r.Gaps)
+	}
+	duplicates := [][]string{{"CN2601002", "CN260200002"}}
+	if !reflect.DeepEqual(r.Duplicates, duplicates) {
+		t.Error("expected", duplicates, "found", r.Duplicates)
+	}
+	if r.Ok() {
+		t.Error("expected", false, "found", true)
+	}
+
+	if d, _ := duplicateNumber("credit", "CN2603002"); d == "" {
+		t.Error("expected a duplicate found", d)
+	}
+	if d, _ := duplicateNumber("", "2605007"); d != "" {
+		t.Error("expected", "", "found", d)
+	}
+}
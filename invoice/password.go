@@ -0,0 +1,204 @@
+package invoice
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+// PasswordProvider provides the password used to encrypt and decrypt the descriptors
+type PasswordProvider interface {
+	ReadPassword(message string) (string, error)
+}
+
+// terminalPassword prompts the user for the password
+type terminalPassword struct{}
+
+func (terminalPassword) ReadPassword(message string) (string, error) {
+	return ReadUserPassword(message)
+}
+
+// envPassword reads the password from an environment variable
+type envPassword struct {
+	name string
+}
+
+func (p envPassword) ReadPassword(message string) (string, error) {
+	return checkPassword(os.Getenv(p.name), "environment variable "+p.name)
+}
+
+// filePassword reads the password from the first line of a file
+type filePassword struct {
+	path string
+}
+
+func (p filePassword) ReadPassword(message string) (string, error) {
+	rawData, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read the password file: %v", err)
+	}
+	return checkPassword(firstLine(rawData), "password file "+p.path)
+}
+
+// commandPassword reads the password from the first line of the output of a command
+type commandPassword struct {
+	command string
+}
+
+func (p commandPassword) ReadPassword(message string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", p.command)
+	} else {
+		cmd = exec.Command("sh", "-c", p.command)
+	}
+	// the command may need to interact with the user (ex. gpg pinentry)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("password command failed: %v", err)
+	}
+	return checkPassword(firstLine(out), "password command")
+}
+
+// stdinPassword reads the password from the first line of the standard input
+type stdinPassword struct{}
+
+func (stdinPassword) ReadPassword(message string) (string, error) {
+	// read one byte at the time to leave the rest of the input
+	// to the following reads (ex. confirmations)
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("cannot read the password from stdin: %v", err)
+		}
+	}
+	return checkPassword(string(line), "standard input")
+}
+
+// NewPasswordProvider returns the password provider for a password source
+func NewPasswordProvider(source, file, command string) (PasswordProvider, error) {
+	switch source {
+	case "", config.PasswordSourceTerminal:
+		return terminalPassword{}, nil
+	case config.PasswordSourceEnv:
+		return envPassword{config.PasswordEnvVar}, nil
+	case config.PasswordSourceFile:
+		if len(strings.TrimSpace(file)) == 0 {
+			return nil, errors.New("password source is file but no password file is set")
+		}
+		return filePassword{file}, nil
+	case config.PasswordSourceCommand:
+		if len(strings.TrimSpace(command)) == 0 {
+			return nil, errors.New("password source is command but no password command is set")
+		}
+		return commandPassword{command}, nil
+	case config.PasswordSourceStdin:
+		return stdinPassword{}, nil
+	}
+	return nil, fmt.Errorf("unknown password source '%s'", source)
+}
+
+// GetPasswordProvider returns the password provider set in the configuration.
+// If no source is set and the GOVOICE_PASSWORD environment variable is set
+// the password is read from the environment, otherwise from the terminal
+func GetPasswordProvider() (PasswordProvider, error) {
+	source := config.Govoice.PasswordSource
+	if source == "" && os.Getenv(config.PasswordEnvVar) != "" {
+		source = config.PasswordSourceEnv
+	}
+	return NewPasswordProvider(source, config.Govoice.PasswordFile, config.Govoice.PasswordCommand)
+}
+
+// ReadPassword reads the password from the source set in the configuration.
+// When recipients are configured and all the descriptors are already encrypted
+// for them the password is not needed and an empty password is returned
+func ReadPassword(message string) (string, error) {
+	if usingRecipients() {
+		needsPassword, err := WorkspaceNeedsPassword()
+		if err != nil {
+			return "", err
+		}
+		if !needsPassword {
+			return "", nil
+		}
+	}
+	p, err := GetPasswordProvider()
+	if err != nil {
+		return "", err
+	}
+	return p.ReadPassword(message)
+}
+
+// ReadNewPassword reads the new password of the workspace from a password source, the environment
+// source is the GOVOICE_NEW_PASSWORD variable, also used when it is set and no source is given.
+// In the terminal the password is asked twice
+func ReadNewPassword(source, file, command string) (password string, err error) {
+	if source == "" && os.Getenv(config.NewPasswordEnvVar) != "" {
+		source = config.PasswordSourceEnv
+	}
+	switch source {
+	case "", config.PasswordSourceTerminal:
+		if password, err = ReadUserPassword("Enter new password:"); err != nil {
+			return
+		}
+		confirm, err := ReadUserPassword("Confirm new password:")
+		if err != nil {
+			return "", err
+		}
+		if password != confirm {
+			return "", errors.New("the new passwords do not match")
+		}
+		return password, nil
+	case config.PasswordSourceEnv:
+		return envPassword{config.NewPasswordEnvVar}.ReadPassword("")
+	}
+	p, err := NewPasswordProvider(source, file, command)
+	if err != nil {
+		return
+	}
+	return p.ReadPassword("")
+}
+
+// firstLine returns the first line of the data
+func firstLine(data []byte) string {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[:i]
+	}
+	return string(data)
+}
+
+// checkPassword trims the password and checks that is not empty
+func checkPassword(password, source string) (string, error) {
+	password = strings.TrimSpace(password)
+	if len(password) == 0 {
+		return "", fmt.Errorf("empty password from %s", source)
+	}
+	return password, nil
+}
+
+// usingRecipients tells if the descriptors are encrypted for the recipients
+// in the configuration instead that with a password
+func usingRecipients() bool {
+	return len(config.Govoice.Recipients) > 0
+}
@@ -0,0 +1,113 @@
+package invoice
+
+import (
+	"os"
+	"path"
+	"runtime"
+	"testing"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+func TestPasswordProviders(t *testing.T) {
+	tmpHome, _ := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	defer func(c config.MainConfig) { config.Govoice = c }(config.Govoice)
+
+	// file
+	pf := path.Join(tmpHome, "password")
+	writeFile(pf, []byte("  file secret \nsecond line\n"))
+	config.Govoice = config.MainConfig{PasswordSource: config.PasswordSourceFile, PasswordFile: pf}
+	if p, err := ReadPassword(""); p != "file secret" || err != nil {
+		t.Error("expected", "file secret", "found", p, err)
+	}
+
+	// empty file
+	writeFile(pf, []byte("\n"))
+	if _, err := ReadPassword(""); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+
+	// environment, used when no source is set
+	os.Setenv(config.PasswordEnvVar, "env secret")
+	defer os.Unsetenv(config.PasswordEnvVar)
+	config.Govoice = config.MainConfig{}
+	if p, err := ReadPassword(""); p != "env secret" || err != nil {
+		t.Error("expected", "env secret", "found", p, err)
+	}
+
+	// command
+	if runtime.GOOS != "windows" {
+		config.Govoice = config.MainConfig{PasswordSource: config.PasswordSourceCommand, PasswordCommand: "echo command secret"}
+		if p, err := ReadPassword(""); p != "command secret" || err != nil {
+			t.Error("expected", "command secret", "found", p, err)
+		}
+		config.Govoice.PasswordCommand = "exit 1"
+		if _, err := ReadPassword(""); err == nil {
+			t.Error("unexpected", nil, "as error")
+		}
+	}
+
+	// stdin
+	r, w, _ := os.Pipe()
+	defer func(f *os.File) { os.Stdin = f }(os.Stdin)
+	os.Stdin = r
+	w.Write([]byte("stdin secret\nyes\n"))
+	w.Close()
+	config.Govoice = config.MainConfig{PasswordSource: config.PasswordSourceStdin}
+	if p, err := ReadPassword(""); p != "stdin secret" || err != nil {
+		t.Error("expected", "stdin secret", "found", p, err)
+	}
+	// the rest of the input is still available
+	if reply := ReadUserInput(""); reply != "yes" {
+		t.Error("expected", "yes", "found", reply)
+	}
+
+	// misconfigurations
+	for _, c := range []config.MainConfig{
+		{PasswordSource: "keychain"},
+		{PasswordSource: config.PasswordSourceFile},
+		{PasswordSource: config.PasswordSourceCommand},
+	} {
+		config.Govoice = c
+		if _, err := GetPasswordProvider(); err == nil {
+			t.Error("unexpected", nil, "as error for", c.PasswordSource)
+		}
+	}
+}
+
+func TestReadNewPassword(t *testing.T) {
+	tmpHome, _ := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+
+	os.Setenv(config.NewPasswordEnvVar, "new env secret")
+	if p, err := ReadNewPassword("", "", ""); p != "new env secret" || err != nil {
+		t.Error("expected", "new env secret", "found", p, err)
+	}
+	os.Unsetenv(config.NewPasswordEnvVar)
+	if _, err := ReadNewPassword(config.PasswordSourceEnv, "", ""); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+
+	pf := path.Join(tmpHome, "new password")
+	writeFile(pf, []byte("new file secret\n"))
+	if p, err := ReadNewPassword(config.PasswordSourceFile, pf, ""); p != "new file secret" || err != nil {
+		t.Error("expected", "new file secret", "found", p, err)
+	}
+
+	// the current and the new password from the standard input
+	r, w, _ := os.Pipe()
+	defer func(f *os.File) { os.Stdin = f }(os.Stdin)
+	os.Stdin = r
+	w.Write([]byte("old secret\nnew secret\n"))
+	w.Close()
+	defer func(c config.MainConfig) { config.Govoice = c }(config.Govoice)
+	config.Govoice = config.MainConfig{PasswordSource: config.PasswordSourceStdin}
+	old, err := ReadPassword("")
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if p, err := ReadNewPassword(config.PasswordSourceStdin, "", ""); old != "old secret" || p != "new secret" || err != nil {
+		t.Error("expected", "old secret", "new secret", "found", old, p, err)
+	}
+}
@@ -0,0 +1,278 @@
+package invoice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+// Errors
+var (
+	ErrPaymentAmountInvalid = errors.New("the payment amount must be greater than zero")
+	ErrInvoiceAlreadyPaid   = errors.New("invoice already paid")
+	ErrInvoiceCredited      = errors.New("invoice credited, no payment is due")
+)
+
+// PaymentStatuses are the payment statuses of an invoice
+var PaymentStatuses = []string{
+	config.StatusOpen,
+	config.StatusPartiallyPaid,
+	config.StatusPaid,
+	config.StatusOverdue,
+	config.StatusCredited,
+}
+
+// Payment is a payment received for an invoice
+type Payment struct {
+	Invoice string    `json:"invoice"`
+	Amount  Money     `json:"amount"`
+	Date    time.Time `json:"date"`
+	Method  string    `json:"method,omitempty"`
+}
+
+// Credit links a credited invoice to its credit note
+type Credit struct {
+	Invoice    string    `json:"invoice"`
+	CreditNote string    `json:"credit_note"`
+	Date       time.Time `json:"date"`
+}
+
+// PaymentLedger is the list of the payments received and of the credited invoices,
+// stored encrypted in the workspace
+type PaymentLedger struct {
+	Payments []Payment `json:"payments"`
+	Credits  []Credit  `json:"credits,omitempty"`
+}
+
+// CreditedBy returns the credit note of an invoice, empty if the invoice is not credited
+func (l *PaymentLedger) CreditedBy(invoiceNumber string) string {
+	for _, c := range l.Credits {
+		if c.Invoice == invoiceNumber {
+			return c.CreditNote
+		}
+	}
+	return ""
+}
+
+// Paid returns the sum of the payments received for an invoice
+func (l *PaymentLedger) Paid(invoiceNumber string) (paid Money) {
+	for _, p := range l.Payments {
+		if p.Invoice == invoiceNumber {
+			paid = paid.Add(p.Amount)
+		}
+	}
+	return
+}
+
+// unsettledAt returns the entries open or partially paid at a date, with the balances
+// computed from the payments and the credits of the ledger dated up to the date
+func (l *PaymentLedger) unsettledAt(entries []InvoiceEntry, date time.Time) (unsettled []InvoiceEntry) {
+	end := startOfDay(date).AddDate(0, 0, 1)
+	for _, ie := range entries {
+		ie.CreditedBy = ""
+		for _, c := range l.Credits {
+			if c.Invoice == ie.Number && c.Date.Before(end) {
+				ie.CreditedBy = c.CreditNote
+			}
+		}
+		var paid Money
+		for _, p := range l.Of(ie.Number) {
+			if p.Date.Before(end) {
+				paid = paid.Add(p.Amount)
+			}
+		}
+		ie.setPaid(paid)
+		if ie.Status == config.StatusOpen || ie.Status == config.StatusPartiallyPaid {
+			unsettled = append(unsettled, ie)
+		}
+	}
+	return
+}
+
+// Of returns the payments received for an invoice
+func (l *PaymentLedger) Of(invoiceNumber string) (payments []Payment) {
+	for _, p := range l.Payments {
+		if p.Invoice == invoiceNumber {
+			payments = append(payments, p)
+		}
+	}
+	return
+}
+
+// PaymentStatus is the payment status of an invoice
+type PaymentStatus struct {
+	Number      string
+	Status      string
+	Currency    string
+	Due         time.Time
+	Total       Money
+	Paid        Money
+	Outstanding Money
+	Payments    []Payment
+}
+
+// ReadPaymentLedger decrypts the payment ledger of the workspace,
+// the ledger is empty if no payment has been recorded yet
+func ReadPaymentLedger(password string) (l PaymentLedger, err error) {
+	ledgerPath, exists := config.GetPaymentLedgerPath()
+	if !exists {
+		return
+	}
+	rawData, err := ioutil.ReadFile(ledgerPath)
+	if err != nil {
+		return
+	}
+	if rawData, err = decryptDescriptor(password, rawData); err != nil {
+		return
+	}
+	err = json.Unmarshal(rawData, &l)
+	return
+}
+
+// writePaymentLedger encrypts and writes the payment ledger in the workspace
+func writePaymentLedger(l *PaymentLedger, password string) error {
+	content, err := json.MarshalIndent(*l, "", "  ")
+	if err != nil {
+		return err
+	}
+	encContent, err := encryptDescriptor(password, content)
+	if err != nil {
+		return err
+	}
+	ledgerPath, _ := config.GetPaymentLedgerPath()
+	return writeFileAtomic(ledgerPath, encContent)
+}
+
+// RecordPayment adds a payment of an invoice to the ledger and updates the status of the invoice
+// in the search index. If the amount is zero the payment is the outstanding balance.
+// The credited invoices cannot be paid. Returns the payment status of the invoice after the payment
+func RecordPayment(invoiceNumber string, amount float64, date time.Time, method, password string) (status PaymentStatus, err error) {
+	i, err := readArchivedInvoice(invoiceNumber, password)
+	if err != nil {
+		return
+	}
+	ledger, err := ReadPaymentLedger(password)
+	if err != nil {
+		return
+	}
+	cn := ledger.CreditedBy(invoiceNumber)
+	status = paymentStatus(&i, &ledger, cn, time.Now())
+	if cn != "" {
+		err = fmt.Errorf("%v by %s", ErrInvoiceCredited, cn)
+		return
+	}
+
+	p := Payment{Invoice: invoiceNumber, Amount: moneyFromFloat(amount, status.Currency), Date: date, Method: strings.TrimSpace(method)}
+	if amount == 0 {
+		if status.Outstanding.Amount <= 0 {
+			err = ErrInvoiceAlreadyPaid
+			return
+		}
+		p.Amount = status.Outstanding
+	}
+	if p.Amount.Amount <= 0 {
+		err = ErrPaymentAmountInvalid
+		return
+	}
+	ledger.Payments = append(ledger.Payments, p)
+	if err = writePaymentLedger(&ledger, password); err != nil {
+		return
+	}
+	status = paymentStatus(&i, &ledger, cn, time.Now())
+
+	ie, err := invoiceEntry(&i)
+	if err != nil {
+		return
+	}
+	ie.CreditedBy = cn
+	ie.setPaid(status.Paid)
+	err = updateSearchIndex(ie)
+	return
+}
+
+// GetPaymentStatus returns the payment status and the payments of an invoice
+func GetPaymentStatus(invoiceNumber, password string) (status PaymentStatus, err error) {
+	i, err := readArchivedInvoice(invoiceNumber, password)
+	if err != nil {
+		return
+	}
+	ledger, err := ReadPaymentLedger(password)
+	if err != nil {
+		return
+	}
+	status = paymentStatus(&i, &ledger, ledger.CreditedBy(invoiceNumber), time.Now())
+	return
+}
+
+// readArchivedInvoice decrypts the descriptor of an invoice in the workspace
+func readArchivedInvoice(invoiceNumber, password string) (i Invoice, err error) {
+	descriptorPath, exists := config.GetInvoiceJsonPath(invoiceNumber)
+	if !exists {
+		err = fmt.Errorf("invoice %s not found in %s", invoiceNumber, descriptorPath)
+		return
+	}
+	return readInvoiceDescriptorEncrypted(descriptorPath, password)
+}
+
+// paymentStatus computes the payment status of an invoice at a given time
+func paymentStatus(i *Invoice, l *PaymentLedger, creditedBy string, now time.Time) PaymentStatus {
+	_, total := i.GetTotals()
+	paid := l.Paid(i.Invoice.Number)
+	paid.Currency = total.Currency
+	due := invoiceDue(i)
+	return PaymentStatus{
+		Number:      i.Invoice.Number,
+		Status:      currentStatus(settlementStatus(total, paid, creditedBy), due, now),
+		Currency:    currencyOf(i.Settings.Currency),
+		Due:         due,
+		Total:       total,
+		Paid:        paid,
+		Outstanding: total.Sub(paid),
+		Payments:    l.Of(i.Invoice.Number),
+	}
+}
+
+// settlementStatus returns the status of an invoice from the payments received, without
+// considering the due date: credited, paid, partially paid or open
+func settlementStatus(total, paid Money, creditedBy string) string {
+	switch {
+	case creditedBy != "":
+		return config.StatusCredited
+	case total.Sub(paid).Amount <= 0:
+		return config.StatusPaid
+	case paid.Amount > 0:
+		return config.StatusPartiallyPaid
+	}
+	return config.StatusOpen
+}
+
+// currentStatus returns overdue if the invoice is not settled after the due date
+func currentStatus(status string, due, now time.Time) string {
+	if (status == config.StatusOpen || status == config.StatusPartiallyPaid) && due.Before(startOfDay(now)) {
+		return config.StatusOverdue
+	}
+	return status
+}
+
+// invoiceDue returns the due date of the invoice, or the invoice date
+// if the due date is missing or does not match the date format
+func invoiceDue(i *Invoice) time.Time {
+	format := i.Settings.DateInputFormat
+	if len(format) == 0 {
+		format = config.Govoice.DateInputFormat
+	}
+	if d, err := time.Parse(dateFormatToLayout(format), i.Invoice.Due); err == nil {
+		return d
+	}
+	return invoiceDate(i)
+}
+
+// startOfDay truncates a time to the midnight of the same day
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
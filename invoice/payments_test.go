@@ -0,0 +1,144 @@
+package invoice
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+func TestSettlementStatus(t *testing.T) {
+	now := time.Date(2026, 5, 10, 15, 0, 0, 0, time.Local)
+	past := time.Date(2026, 5, 9, 0, 0, 0, 0, time.UTC)
+	today := time.Date(2026, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		total, paid int64
+		creditedBy  string
+		due         time.Time
+		expected    string
+	}{
+		{10000, 0, "", today, config.StatusOpen},
+		{10000, 0, "", past, config.StatusOverdue},
+		{10000, 4000, "", today, config.StatusPartiallyPaid},
+		{10000, 4000, "", past, config.StatusOverdue},
+		{10000, 10000, "", past, config.StatusPaid},
+		{10000, 12000, "", past, config.StatusPaid},
+		{10000, 0, "CN-1", past, config.StatusCredited},
+		{-10000, 0, "", past, config.StatusPaid},
+	}
+	for _, tt := range tests {
+		s := settlementStatus(Money{Amount: tt.total}, Money{Amount: tt.paid}, tt.creditedBy)
+		if s = currentStatus(s, tt.due, now); s != tt.expected {
+			t.Error("expected", tt.expected, "found", s)
+		}
+	}
+}
+
+func TestRecordPayment(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	if _, _, err := Setup(tmpWorkspace); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	writeTestDescriptors(t, "password", "0001")
+	// the items of the test invoice have no price
+	p, _ := config.GetInvoiceJsonPath("0001")
+	i, _ := readInvoiceDescriptorEncrypted(p, "password")
+	i.Settings.ItemsPrice = 45
+	if err := writeInvoiceDescriptorEncrypted(&i, p, "password"); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	date := time.Date(2026, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	// the test invoice is due in 2017
+	s, err := GetPaymentStatus("0001", "password")
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if s.Status != config.StatusOverdue || s.Outstanding.String() != "803.25" || len(s.Payments) != 0 {
+		t.Error("expected", config.StatusOverdue, "803.25", 0, "found", s.Status, s.Outstanding, len(s.Payments))
+	}
+	total := s.Total
+
+	if _, err = RecordPayment("0001", -5, date, "", "password"); err != ErrPaymentAmountInvalid {
+		t.Error("expected", ErrPaymentAmountInvalid, "found", err)
+	}
+	if _, err = RecordPayment("missing", 5, date, "", "password"); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+
+	// partial payment
+	if s, err = RecordPayment("0001", 100.5, date, "transfer", "password"); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if s.Paid.String() != "100.50" || s.Outstanding != total.Sub(s.Paid) || s.Status != config.StatusOverdue {
+		t.Error("expected", "100.50", total.Sub(s.Paid), config.StatusOverdue, "found", s.Paid, s.Outstanding, s.Status)
+	}
+	// the rest of the balance
+	if s, err = RecordPayment("0001", 0, date, "cash", "password"); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if s.Status != config.StatusPaid || !s.Outstanding.IsZero() || len(s.Payments) != 2 {
+		t.Error("expected", config.StatusPaid, 0, 2, "found", s.Status, s.Outstanding, len(s.Payments))
+	}
+	if _, err = RecordPayment("0001", 0, date, "", "password"); err != ErrInvoiceAlreadyPaid {
+		t.Error("expected", ErrInvoiceAlreadyPaid, "found", err)
+	}
+
+	// the ledger is encrypted
+	if _, err = ReadPaymentLedger("wrong"); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+	l, err := ReadPaymentLedger("password")
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if len(l.Payments) != 2 || l.Payments[0].Method != "transfer" || !l.Payments[0].Date.Equal(date) {
+		t.Error("unexpected ledger", l)
+	}
+	// the ledger is re-encrypted with the descriptors
+	if n, err := RekeyWorkspace("password", "new password", RekeyOptions{}); err != nil || n != 2 {
+		t.Error("expected", 2, nil, "found", n, err)
+	}
+	if l, err = ReadPaymentLedger("new password"); err != nil || len(l.Payments) != 2 {
+		t.Error("expected", 2, nil, "found", len(l.Payments), err)
+	}
+}
+
+func TestLedgerEntry(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	if _, _, err := Setup(tmpWorkspace); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	i := masterInvoice()
+	i.Invoice.Number = "0001"
+	i.Settings.ItemsPrice = 45
+	_, total := i.GetTotals()
+
+	// an invoice rendered again keeps the payments of the ledger
+	ledger := PaymentLedger{Payments: []Payment{{Invoice: "0001", Amount: Money{Amount: 1000}}}}
+	if err := writePaymentLedger(&ledger, "password"); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	ie, err := ledgerEntry(&i, "password")
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if ie.Paid != 10 || ie.Outstanding != total.Float64()-10 || ie.Status != config.StatusPartiallyPaid {
+		t.Error("expected", 10, config.StatusPartiallyPaid, "found", ie.Paid, ie.Status)
+	}
+	// and its credit note
+	ledger.Credits = []Credit{{Invoice: "0001", CreditNote: "CN-0001"}}
+	if err = writePaymentLedger(&ledger, "password"); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if ie, err = ledgerEntry(&i, "password"); err != nil || ie.CreditedBy != "CN-0001" || ie.Status != config.StatusCredited {
+		t.Error("expected", "CN-0001", config.StatusCredited, "found", ie.CreditedBy, ie.Status, err)
+	}
+	if _, err = ledgerEntry(&i, "wrong"); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+}
@@ -3,6 +3,7 @@ package invoice
 import (
 	"bytes"
 	"log"
+	"math"
 	"os"
 	"strconv"
 	"strings"
@@ -31,6 +32,7 @@ const (
 
 	fontStyleBold     = "B"
 	fontStyleNormal   = ""
+	fontStyleItalic   = "I"
 	textAlignRightMid = "RM"
 	textAlignRightTop = "RT"
 	textAlignRightBtm = "RB"
@@ -45,8 +47,24 @@ const (
 	sectionPayments = "payments"
 	sectionNotes    = "notes"
 	sectionDetails  = "details"
+
+	defaultLabelDiscount   = "discount"
+	defaultCreditNoteTitle = "CREDIT NOTE"
+
+	// aliasPages is replaced with the total pages of the pdf
+	aliasPages = "{nb}"
 )
 
+// PageData is the data of the header and footer templates
+type PageData struct {
+	// Page is the page number
+	Page int
+	// Pages is the total pages
+	Pages  string
+	Number string
+	From   Recipient
+}
+
 func applyTemplate(s *Section, data interface{}) (err error) {
 	// workaround remove tab from template
 	s.Template = strings.Replace(s.Template, "\t", "", -1)
@@ -100,24 +118,55 @@ func RenderPDF(invoice *Invoice, pdfPath string, tpl *InvoiceTemplate) {
 	pdf.SetMargins(tpl.Page.Margins.Left,
 		tpl.Page.Margins.Top,
 		tpl.Page.Margins.Right)
+	// the bottom margin is where the pages break, the default of gofpdf if not set
+	if tpl.Page.Margins.Bottom > 0 {
+		pdf.SetAutoPageBreak(true, tpl.Page.Margins.Bottom)
+	}
+	// the letterhead of the template
+	drawLetterhead := func() {}
+	if tpl.Page.Background != "" {
+		var err error
+		if drawLetterhead, err = loadLetterhead(pdf, tpl.Page.Background); err != nil {
+			log.Fatal("Error: ", err)
+		}
+	}
+	// draw the background, the images, the header and the footer of every page
+	pdf.AliasNbPages(aliasPages)
+	pageData := func() PageData {
+		return PageData{Page: pdf.PageNo(), Pages: aliasPages, Number: invoice.Invoice.Number, From: invoice.From}
+	}
+	// the end of the header of the current page, the table continues below it
+	headerEnd := 0.0
+	pdf.SetHeaderFuncMode(func() {
+		renderBackground(pdf, &tpl.Page)
+		drawLetterhead()
+		if err := renderImages(pdf, tpl); err != nil {
+			log.Fatal("Error: ", err)
+		}
+		headerEnd = renderRunningBlock(pdf, tpl.Header, &tpl.Page, pageData(), false)
+	}, true)
+	pageTop := func() float64 {
+		return continuationTop(&tpl.Page, headerEnd)
+	}
+	pdf.SetFooterFunc(func() {
+		renderRunningBlock(pdf, tpl.Footer, &tpl.Page, pageData(), true)
+	})
 	defer pdf.Close()
+	// the fonts of the template
+	if err := loadFonts(pdf, &tpl.Page.Font); err != nil {
+		log.Fatal("Error: ", err)
+	}
 	// unicode font symbol (adding trailing space for better rendering)
-	utf8 := pdf.UnicodeTranslatorFromDescriptor("")
+	utf8 := textTranslator(pdf, &tpl.Page)
 	currencySymbol := utf8(invoice.Settings.CurrencySymbol + " ")
 
+	// set the font color, before the header of the first page
+	pdf.SetTextColor(computeColors(tpl.Page.FontColor, blackR, blackG, blackB))
 	// add a page to the pdf
 	pdf.AddPage()
 	// get page size and margins
 	w, h := pdf.GetPageSize()
-	ml, _, _, _ := pdf.GetMargins()
-	// draw the background
-	fr, fg, fb := pdf.GetFillColor()
-	pdf.SetFillColor(computeColors(tpl.Page.BackgroundColor, whiteR, whiteG, whiteB))
-	pdf.Rect(.0, .0, w, h, "FD")
-	// restore the fill colors
-	pdf.SetFillColor(fr, fg, fb)
-	// set the font color
-	pdf.SetTextColor(computeColors(tpl.Page.FontColor, blackR, blackG, blackB))
+	ml, _, _, mb := pdf.GetMargins()
 
 	// title
 	title := utf8(strings.ToUpper(invoice.From.Name))
@@ -132,6 +181,12 @@ func RenderPDF(invoice *Invoice, pdfPath string, tpl *InvoiceTemplate) {
 	var section Section
 	// invoice data
 	section = tpl.Sections[sectionInvoice]
+	if invoice.Invoice.CreditNoteOf != "" {
+		section.Title = tpl.Page.CreditNoteTitle
+		if section.Title == "" {
+			section.Title = defaultCreditNoteTitle
+		}
+	}
 	applyTemplate(&section, invoice.Invoice)
 	renderBlock(pdf, &section, &tpl.Page)
 
@@ -163,28 +218,30 @@ func RenderPDF(invoice *Invoice, pdfPath string, tpl *InvoiceTemplate) {
 	c2w := tableMaxWidth * (tpl.Page.Table.Col2W / 100)
 	c3w := tableMaxWidth * (tpl.Page.Table.Col3W / 100)
 	c4w := tableMaxWidth * (tpl.Page.Table.Col4W / 100)
-	// create th row styles
-	headerRowStyle := RowStyle{[]float64{c1w, c2w, c3w, c4w}, tpl.Page.Table.HeadHeight, borderNone, textAlignLeftMid, fill}
-	normalRowStyle := RowStyle{[]float64{c1w, c2w, c3w, c4w}, tpl.Page.Table.RowHeight, borderBottom, textAlignLeftMid, noFill}
+	// create the table with the row styles, the rows break at the bottom margin
+	items := itemsTable{
+		pdf:     pdf,
+		section: &section,
+		page:    &tpl.Page,
+		header:  RowStyle{[]float64{c1w, c2w, c3w, c4w}, tpl.Page.Table.HeadHeight, borderNone, textAlignLeftMid, fill},
+		row:     RowStyle{[]float64{c1w, c2w, c3w, c4w}, tpl.Page.Table.RowHeight, borderBottom, textAlignLeftMid, noFill},
+		bottom:  h - mb,
+		top:     pageTop,
+	}
 
 	// write headers
-	tr, tg, tb := pdf.GetTextColor()
-	fr, fg, fb = pdf.GetFillColor()
-
-	pdf.SetTextColor(computeColors(tpl.Page.Table.HeaderFontColor, tr, tg, tb))
-	pdf.SetFillColor(computeColors(tpl.Page.Table.HeaderBackgroundColor, fr, fg, fb))
-
 	data := tpl.Page.Table.Header
 	// table header console
 	table.SetHeader(data)
-	renderRow(pdf, &section, &headerRowStyle, data)
-
-	// restore the colors
-	pdf.SetTextColor(tr, tg, tb)
-	pdf.SetFillColor(fr, fg, fb)
+	items.renderHeader()
 
 	// keep the subtotal
-	ac := accounting.Accounting{Symbol: currencySymbol, Precision: 2}
+	ac := accounting.Accounting{Symbol: currencySymbol, Precision: CurrencyDecimals(invoice.Settings.Currency)}
+	// templates created before the discounts have no label for them
+	labelDiscount := tpl.Page.Table.LabelDiscount
+	if labelDiscount == "" {
+		labelDiscount = defaultLabelDiscount
+	}
 
 	//  log.Print(invoice.Items)
 	if invoice.Items == nil {
@@ -199,58 +256,103 @@ func RenderPDF(invoice *Invoice, pdfPath string, tpl *InvoiceTemplate) {
 
 		// get the price and the cost of the item
 		// price can be global or per item
-		itemPrice, itemCost := it.GetCost(&invoice.Settings.ItemsPrice, &invoice.Settings.RoundQuantity)
+		itemPrice, itemCost := it.GetCost(&invoice.Settings)
 		// print column 3 and 4
-		c3v = ac.FormatMoney(itemPrice)
-		c4v = ac.FormatMoney(itemCost)
+		c3v = ac.FormatMoney(itemPrice.Float64())
+		c4v = ac.FormatMoney(itemCost.Float64())
 
-		data = []string{c1v, c2v, c3v, c4v}
+		rows := [][]string{{c1v, c2v, c3v, c4v}}
+		// item discount in its own row
+		if !it.Discount.IsEmpty() {
+			rows = append(rows, []string{labelDiscount, "", it.Discount.Label(), ac.FormatMoney(it.GetDiscount(&invoice.Settings).Neg().Float64())})
+		}
 		// append data for the console output
-		table.Append(data)
-		// render pdf row
-		renderRow(pdf, &section, &normalRowStyle, data)
+		table.AppendBulk(rows)
+		// render pdf rows, the discount on the same page of the item
+		items.renderRows(rows...)
 	}
-	pdf.Ln(tpl.Page.Table.RowHeight)
 	// total and subtotal
 	subtotal, total := invoice.GetTotals()
+	discount := invoice.GetDiscount()
 
-	// subtotal
-	c1v, c2v, c3v, c4v = tpl.Page.Table.LabelSubtotal, "", "", ac.FormatMoney(subtotal)
-	data = []string{c1v, c2v, c3v, c4v}
-	// append data for the console output
-	table.Append(data)
-	// render pdf
-	pdf.SetX(section.X)
-	renderRow(pdf, &section, &normalRowStyle, data)
+	// the rows of the totals are rendered together after the items
+	var totals [][]string
+	// subtotal, before the invoice discount
+	c1v, c2v, c3v, c4v = tpl.Page.Table.LabelSubtotal, "", "", ac.FormatMoney(subtotal.Add(discount).Float64())
+	totals = append(totals, []string{c1v, c2v, c3v, c4v})
 
-	// vat
-	c1v, c2v, c3v, c4v = tpl.Page.Table.LabelTax, "", strconv.FormatFloat(invoice.Settings.VatRate, 'f', 2, 64)+" %", ac.FormatMoney(total-subtotal)
-	data = []string{c1v, c2v, c3v, c4v}
-	// append data for the console output
-	table.Append([]string{c1v, c2v, c3v, c4v})
-	renderRow(pdf, &section, &normalRowStyle, data)
+	// invoice discount
+	if !invoice.Discount.IsEmpty() {
+		totals = append(totals, []string{labelDiscount, "", invoice.Discount.Label(), ac.FormatMoney(discount.Neg().Float64())})
+	}
 
-	// total
-	pdf.SetFont(tpl.Page.Font.Family, fontStyleBold, tpl.Page.Font.SizeNormal)
+	// taxes, one row for each rate
+	taxes := invoice.GetTaxes()
+	if len(taxes) == 0 {
+		taxes = []TaxLine{TaxLine{Rate: invoice.Settings.VatRate}}
+	}
+	for _, t := range taxes {
+		// with more rates show also the taxable amount
+		c2v = ""
+		if len(taxes) > 1 {
+			c2v = ac.FormatMoney(t.Base.Float64())
+		}
+		c1v, c3v, c4v = tpl.Page.Table.LabelTax, strconv.FormatFloat(t.Rate, 'f', 2, 64)+" %", ac.FormatMoney(t.Amount.Float64())
+		totals = append(totals, []string{c1v, c2v, c3v, c4v})
+	}
+
+	// additional taxes, with the taxable amount
+	for _, at := range invoice.GetAdditionalTaxes() {
+		label, exists := tpl.Page.Table.LabelsAdditionalTaxes[at.Name]
+		if !exists {
+			label = at.Name
+		}
+		totals = append(totals, []string{utf8(label), ac.FormatMoney(at.Base.Float64()), strconv.FormatFloat(at.Rate, 'f', 2, 64) + " %", ac.FormatMoney(at.Amount.Float64())})
+	}
 
-	c1v, c2v, c3v, c4v = tpl.Page.Table.LabelTotal, "", "", ac.FormatMoney(total)
-	data = []string{c1v, c2v, c3v, c4v}
+	// total
+	c1v, c2v, c3v, c4v = tpl.Page.Table.LabelTotal, "", "", ac.FormatMoney(total.Float64())
+	totals = append(totals, []string{c1v, c2v, c3v, c4v})
 	// append data for the console output
-	table.Append(data)
-	renderRow(pdf, &section, &normalRowStyle, data)
+	table.AppendBulk(totals)
+	// render pdf, the totals on the last page after a blank row
+	items.keep(float64(len(totals)+1) * tpl.Page.Table.RowHeight)
+	pdf.Ln(tpl.Page.Table.RowHeight)
+	items.renderRows(totals[:len(totals)-1]...)
+	pdf.SetFont(tpl.Page.Font.Family, fontStyleBold, tpl.Page.Font.SizeNormal)
+	items.renderRows(totals[len(totals)-1])
 
 	// render console table
 	table.Render()
 
 	// payment details
-	section = tpl.Sections[sectionPayments]
-	applyTemplate(&section, invoice.PaymentDetails)
-	renderBlock(pdf, &section, &tpl.Page)
+	payments := tpl.Sections[sectionPayments]
+	applyTemplate(&payments, invoice.PaymentDetails)
 
 	// notes
-	section = tpl.Sections[sectionNotes]
-	applyTemplate(&section, invoice.Notes)
-	renderBlock(pdf, &section, &tpl.Page)
+	notesSection := tpl.Sections[sectionNotes]
+	notes := invoice.Notes
+	// the note required by the tax treatment goes first
+	if note := treatmentNote(invoice, tpl); note != "" {
+		notes = append([]string{note}, notes...)
+	}
+	applyTemplate(&notesSection, notes)
+
+	// move the sections after the table if it overlaps them
+	footer := []*Section{&payments, &notesSection}
+	reflowSections(pdf, footer, &tpl.Page, pdf.GetY(), items.bottom, pageTop)
+	for _, s := range footer {
+		renderBlock(pdf, s, &tpl.Page)
+	}
+
+	// the payment code moves with the payment details
+	if tpl.PaymentCode.Size > 0 {
+		offset := payments.Y - tpl.Page.Margins.Top - math.Max(tpl.Sections[sectionPayments].Y, 0)
+		if err := renderPaymentCode(pdf, &tpl.PaymentCode, &tpl.Page, invoice, offset); err != nil {
+			log.Println("payment code not rendered:", err)
+			pdf.ClearError()
+		}
+	}
 
 	// render pdf
 	err := pdf.OutputFileAndClose(pdfPath)
@@ -263,10 +365,45 @@ func RenderPDF(invoice *Invoice, pdfPath string, tpl *InvoiceTemplate) {
 func renderBlock(pdf *gofpdf.Fpdf, s *Section, page *Page) {
 	// adjust x/y
 	computeCoordinates(s, &page.Margins)
+	drawBlock(pdf, s, page)
+}
+
+// renderRunningBlock renders the header or the footer of a page, positioned from
+// the top or the bottom of the page (the bottom margin for a footer without y).
+// Returns the y of the end of the block, 0 if nothing is rendered
+func renderRunningBlock(pdf *gofpdf.Fpdf, s Section, page *Page, data PageData, footer bool) (end float64) {
+	if len(s.Template) == 0 {
+		return
+	}
+	if err := applyTemplate(&s, data); err != nil {
+		log.Println("error rendering the header or footer:", err)
+		return
+	}
+	s.X = math.Max(s.X, 0) + page.Margins.Left
+	s.Y = math.Max(s.Y, 0)
+	if footer {
+		_, h := pdf.GetPageSize()
+		if s.Y == 0 {
+			_, _, _, s.Y = pdf.GetMargins()
+		}
+		s.Y = h - s.Y
+	}
+	drawBlock(pdf, &s, page)
+	return pdf.GetY()
+}
+
+// continuationTop returns the y of the content continued on a new page: the top margin plus
+// the continuation offset of the table (ex. for a letterhead), or below the header if it is lower
+func continuationTop(page *Page, headerEnd float64) float64 {
+	return math.Max(page.Margins.Top+math.Max(page.Table.ContinuationTop, 0), headerEnd)
+}
+
+// drawBlock draws a block at the coordinates of the section
+func drawBlock(pdf *gofpdf.Fpdf, s *Section, page *Page) {
 	// copy the x,y values
 	x, y := s.X, s.Y
 	// this is necessary to handle unicode string
-	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	tr := textTranslator(pdf, page)
 	//
 	pdf.SetXY(x, y)
 	if len(s.Title) > 0 {
@@ -299,6 +436,99 @@ func renderRow(pdf *gofpdf.Fpdf, s *Section, rs *RowStyle, colValues []string) {
 	pdf.Ln(rs.Height)
 }
 
+// renderBackground draws the background of the page
+func renderBackground(pdf *gofpdf.Fpdf, page *Page) {
+	w, h := pdf.GetPageSize()
+	fr, fg, fb := pdf.GetFillColor()
+	pdf.SetFillColor(computeColors(page.BackgroundColor, whiteR, whiteG, whiteB))
+	pdf.Rect(.0, .0, w, h, "FD")
+	// restore the fill colors
+	pdf.SetFillColor(fr, fg, fb)
+}
+
+// itemsTable is the table of the items, when the rows reach the bottom of the page
+// the table continues on a new page with the header repeated
+type itemsTable struct {
+	pdf     *gofpdf.Fpdf
+	section *Section
+	page    *Page
+	header  RowStyle
+	row     RowStyle
+	// bottom is the lowest y of the rows
+	bottom float64
+	// top returns the y of the rows continued on a new page
+	top func() float64
+}
+
+// renderHeader renders the header of the table with the header colors
+func (t *itemsTable) renderHeader() {
+	tr, tg, tb := t.pdf.GetTextColor()
+	fr, fg, fb := t.pdf.GetFillColor()
+	t.pdf.SetTextColor(computeColors(t.page.Table.HeaderFontColor, tr, tg, tb))
+	t.pdf.SetFillColor(computeColors(t.page.Table.HeaderBackgroundColor, fr, fg, fb))
+	renderRow(t.pdf, t.section, &t.header, t.page.Table.Header)
+	// restore the colors
+	t.pdf.SetTextColor(tr, tg, tb)
+	t.pdf.SetFillColor(fr, fg, fb)
+}
+
+// keep continues the table on a new page if the height does not fit in the current one
+func (t *itemsTable) keep(height float64) {
+	if t.pdf.GetY()+height <= t.bottom {
+		return
+	}
+	// the font of the rows is restored after the header
+	family, style, size := t.page.Font.Family, fontStyleNormal, t.page.Font.SizeNormal
+	t.pdf.AddPage()
+	t.pdf.SetY(t.top())
+	t.pdf.SetFont(family, style, size)
+	t.renderHeader()
+}
+
+// renderRows renders rows on the same page
+func (t *itemsTable) renderRows(rows ...[]string) {
+	t.keep(float64(len(rows)) * t.row.Height)
+	for _, r := range rows {
+		renderRow(t.pdf, t.section, &t.row, r)
+	}
+}
+
+// reflowSections moves the sections below the end of the table when it overlaps them,
+// keeping their distances, or at the top of a new page (pageTop) if they do not fit in the current one
+func reflowSections(pdf *gofpdf.Fpdf, sections []*Section, page *Page, tableEnd, bottom float64, pageTop func() float64) {
+	top, end := math.MaxFloat64, 0.0
+	for _, s := range sections {
+		y := math.Max(s.Y, 0) + page.Margins.Top
+		top = math.Min(top, y)
+		end = math.Max(end, y+sectionHeight(pdf, s, page))
+	}
+	offset := 0.0
+	if overlap := tableEnd + page.Table.RowHeight - top; overlap > 0 {
+		offset = overlap
+	}
+	if end+offset > bottom {
+		pdf.AddPage()
+		offset = pageTop() - top
+	}
+	for _, s := range sections {
+		s.Y = math.Max(s.Y, 0) + offset
+	}
+}
+
+// sectionHeight returns the height of a section rendered by renderBlock
+func sectionHeight(pdf *gofpdf.Fpdf, s *Section, page *Page) (height float64) {
+	if len(s.Title) > 0 {
+		height += page.Font.LineHeightH2
+	}
+	if len(s.Content) > 0 {
+		w, _ := pdf.GetPageSize()
+		pdf.SetFont(page.Font.Family, fontStyleNormal, page.Font.SizeNormal)
+		lines := pdf.SplitLines([]byte(s.Content), w-math.Max(s.X, 0)-page.Margins.Left-page.Margins.Right)
+		height += float64(len(lines)) * page.Font.LineHeightNormal
+	}
+	return
+}
+
 type RowStyle struct {
 	ColWidths []float64
 	Height    float64
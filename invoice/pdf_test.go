@@ -0,0 +1,151 @@
+package invoice
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// pdfPage matches the page objects of a pdf file
+var pdfPage = regexp.MustCompile(`/Type /Page[^s]`)
+
+func TestRenderPDFPages(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	if _, _, err := Setup(tmpWorkspace); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	tpl := defaultTemplate()
+	pages := map[int]int{1: 1, 60: 2, 120: 4}
+	for n, expected := range pages {
+		i := masterInvoice()
+		items := []Item{}
+		for j := 0; j < n; j++ {
+			items = append(items, Item{Description: "item " + strconv.Itoa(j), Quantity: 1, Price: 10})
+		}
+		i.Items = &items
+		pdfPath := path.Join(tmpWorkspace, strconv.Itoa(n)+".pdf")
+		RenderPDF(&i, pdfPath, &tpl)
+		data, err := ioutil.ReadFile(pdfPath)
+		if err != nil {
+			t.Fatal("unexpected", err, "as error")
+		}
+		if found := len(pdfPage.FindAll(data, -1)); found != expected {
+			t.Error("expected", expected, "pages for", n, "items, found", found)
+		}
+	}
+}
+
+func TestReflowSections(t *testing.T) {
+	tpl := defaultTemplate()
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetFont(tpl.Page.Font.Family, fontStyleNormal, tpl.Page.Font.SizeNormal)
+	pdf.AddPage()
+	payments, notes := Section{Y: 210, Content: "IBAN"}, Section{Y: 240, Content: "thanks"}
+	footer := []*Section{&payments, &notes}
+	top := func() float64 { return tpl.Page.Margins.Top }
+
+	// the table ends before the sections
+	reflowSections(pdf, footer, &tpl.Page, 150, 280, top)
+	if payments.Y != 210 || notes.Y != 240 || pdf.PageNo() != 1 {
+		t.Error("expected", 210, 240, "found", payments.Y, notes.Y, pdf.PageNo())
+	}
+	// the table overlaps the sections, the distance is kept
+	reflowSections(pdf, footer, &tpl.Page, 224, 280, top)
+	if payments.Y != 220 || notes.Y != 250 || pdf.PageNo() != 1 {
+		t.Error("expected", 220, 250, "found", payments.Y, notes.Y, pdf.PageNo())
+	}
+	// the sections do not fit, they move on top of a new page
+	payments.Y, notes.Y = 210, 240
+	reflowSections(pdf, footer, &tpl.Page, 250, 280, top)
+	if payments.Y != 0 || notes.Y != 30 || pdf.PageNo() != 2 {
+		t.Error("expected", 0, 30, "found", payments.Y, notes.Y, pdf.PageNo())
+	}
+	// below the header of the new page
+	payments.Y, notes.Y = 210, 240
+	reflowSections(pdf, footer, &tpl.Page, 250, 280, func() float64 { return tpl.Page.Margins.Top + 20 })
+	if payments.Y != 20 || notes.Y != 50 || pdf.PageNo() != 3 {
+		t.Error("expected", 20, 50, "found", payments.Y, notes.Y, pdf.PageNo())
+	}
+}
+
+func TestContinuationTop(t *testing.T) {
+	tpl := defaultTemplate()
+	tpl.Header = Section{Template: "{{.From.Name}}\nline 2\nline 3\nline 4\nline 5", Y: 5}
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(tpl.Page.Margins.Left, tpl.Page.Margins.Top, tpl.Page.Margins.Right)
+	pdf.SetFont(tpl.Page.Font.Family, fontStyleNormal, tpl.Page.Font.SizeNormal)
+	headerEnd := 0.0
+	pdf.SetHeaderFuncMode(func() {
+		headerEnd = renderRunningBlock(pdf, tpl.Header, &tpl.Page, PageData{Page: pdf.PageNo()}, false)
+	}, true)
+	pdf.AddPage()
+	expected := 5 + 5*tpl.Page.Font.LineHeightNormal
+	if math.Abs(headerEnd-expected) > 0.001 {
+		t.Fatal("expected", expected, "found", headerEnd)
+	}
+
+	// the rows continue below the header, or the continuation offset if it is lower
+	section := Section{X: tpl.Page.Margins.Left}
+	items := itemsTable{
+		pdf:     pdf,
+		section: &section,
+		page:    &tpl.Page,
+		header:  RowStyle{[]float64{40, 20, 20, 20}, tpl.Page.Table.HeadHeight, borderNone, textAlignLeftMid, fill},
+		row:     RowStyle{[]float64{40, 20, 20, 20}, tpl.Page.Table.RowHeight, borderBottom, textAlignLeftMid, noFill},
+		bottom:  250,
+		top:     func() float64 { return continuationTop(&tpl.Page, headerEnd) },
+	}
+	for _, offset := range []float64{0, 60} {
+		tpl.Page.Table.ContinuationTop = offset
+		pdf.SetY(245)
+		items.keep(tpl.Page.Table.RowHeight * 2)
+		top := math.Max(expected, tpl.Page.Margins.Top+offset)
+		if y := pdf.GetY(); math.Abs(y-top-tpl.Page.Table.HeadHeight) > 0.001 {
+			t.Error("expected", top+tpl.Page.Table.HeadHeight, "found", y)
+		}
+	}
+	if pdf.PageNo() != 3 {
+		t.Error("expected", 3, "found", pdf.PageNo())
+	}
+}
+
+func TestRenderRunningBlock(t *testing.T) {
+	tpl := defaultTemplate()
+	tpl.Header = Section{Template: "{{.From.Name}}", Y: 5}
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.SetMargins(tpl.Page.Margins.Left, tpl.Page.Margins.Top, tpl.Page.Margins.Right)
+	pdf.AliasNbPages(aliasPages)
+	pdf.SetFont(tpl.Page.Font.Family, fontStyleNormal, tpl.Page.Font.SizeNormal)
+	data := PageData{Pages: aliasPages, Number: "2026-0014", From: Recipient{Name: "Sender GmbH"}}
+	pdf.SetHeaderFuncMode(func() {
+		data.Page = pdf.PageNo()
+		renderRunningBlock(pdf, tpl.Header, &tpl.Page, data, false)
+	}, true)
+	pdf.SetFooterFunc(func() {
+		renderRunningBlock(pdf, tpl.Footer, &tpl.Page, data, true)
+	})
+	pdf.AddPage()
+	// the header does not move the content of the page
+	if x, y := pdf.GetXY(); x != tpl.Page.Margins.Left || y != tpl.Page.Margins.Top {
+		t.Error("expected", tpl.Page.Margins.Left, tpl.Page.Margins.Top, "found", x, y)
+	}
+	pdf.AddPage()
+	var out bytes.Buffer
+	if err := pdf.Output(&out); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	for _, expected := range []string{"Sender GmbH", "2026-0014 - page 1/2", "2026-0014 - page 2/2"} {
+		if !bytes.Contains(out.Bytes(), []byte(expected)) {
+			t.Error("expected", expected, "in the pdf")
+		}
+	}
+}
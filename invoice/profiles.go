@@ -0,0 +1,176 @@
+package invoice
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+// profileName matches the names of the sender profiles
+var profileName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Profile is a sender profile, for invoicing with more than one business: the sender,
+// the payment details, the numbering and the template of the invoices of a business.
+// Every profile has its own workspace and search index
+type Profile struct {
+	Name string `toml:"-"`
+	// Workspace of the profile, the subfolder NAME of the workspace when empty
+	Workspace string `toml:"workspace"`
+	Template  string `toml:"template"`
+	// numbering of the profile, when the pattern is empty the one of the configuration is used
+	NumberPattern     string            `toml:"numberPattern"`
+	NumberYearlyReset bool              `toml:"numberYearlyReset"`
+	NumberSeries      map[string]string `toml:"numberSeries"`
+
+	From           Recipient       `toml:"from"`
+	PaymentDetails BankCoordinates `toml:"payment_details"`
+}
+
+// activeProfile is the sender profile in use, nil for the default sender
+var activeProfile *Profile
+
+// ReadProfile reads a sender profile from the profiles home
+func ReadProfile(name string) (p Profile, err error) {
+	profilePath, exists := config.GetProfilePath(name)
+	if !exists {
+		err = fmt.Errorf("profile %s not found in %s", name, config.GetProfilesHome())
+		return
+	}
+	rawData, err := ioutil.ReadFile(profilePath)
+	if err != nil {
+		return
+	}
+	if err = toml.Unmarshal(rawData, &p); err != nil {
+		err = fmt.Errorf("invalid profile %s: %v", name, err)
+		return
+	}
+	p.Name = name
+	return
+}
+
+// ListProfiles returns the names of the sender profiles in the profiles home
+func ListProfiles() (names []string, err error) {
+	files, err := ioutil.ReadDir(config.GetProfilesHome())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	ext := fmt.Sprint(".", config.ExtToml)
+	for _, f := range files {
+		if !f.IsDir() && path.Ext(f.Name()) == ext {
+			names = append(names, strings.TrimSuffix(f.Name(), ext))
+		}
+	}
+	return
+}
+
+// AddProfile creates a sender profile, the sender and the payment details are
+// the ones of the master descriptor of the workspace
+func AddProfile(p Profile) (profilePath string, err error) {
+	if !profileName.MatchString(p.Name) {
+		err = fmt.Errorf("invalid profile name '%s', use lowercase letters, digits, - and _", p.Name)
+		return
+	}
+	profilePath, exists := config.GetProfilePath(p.Name)
+	if exists {
+		err = fmt.Errorf("profile %s already exists", p.Name)
+		return
+	}
+	if master, merr := ReadMasterDescriptor(); merr == nil {
+		p.From, p.PaymentDetails = master.From, master.PaymentDetails
+	}
+	if err = os.MkdirAll(config.GetProfilesHome(), 0770); err != nil {
+		return
+	}
+	err = writeTomlToFile(profilePath, p)
+	return
+}
+
+// workspace returns the workspace of the profile
+func (p *Profile) workspace() string {
+	ws := strings.TrimSpace(p.Workspace)
+	if ws == "" {
+		return path.Join(config.Govoice.Workspace, p.Name)
+	}
+	if !filepath.IsAbs(ws) {
+		return path.Join(config.Govoice.Workspace, ws)
+	}
+	return ws
+}
+
+// UseProfile selects the sender profile for the rest of the execution: the workspace,
+// the numbering and the search index of the profile replace the ones of the configuration.
+// The workspace of the profile and its master descriptor are created if missing
+func UseProfile(name string) (p Profile, err error) {
+	if p, err = selectProfile(name); err != nil {
+		return
+	}
+	// the master descriptor of the profile
+	if masterPath, exists := config.GetMasterPath(); !exists {
+		master := masterInvoice()
+		p.apply(&master)
+		err = writeJsonToFile(masterPath, master)
+	}
+	return
+}
+
+// selectProfile switches the workspace, the numbering and the search index
+// to the ones of the sender profile, the workspace is created if missing
+func selectProfile(name string) (p Profile, err error) {
+	if p, err = ReadProfile(name); err != nil {
+		return
+	}
+	ws := p.workspace()
+	if err = os.MkdirAll(ws, 0770); err != nil {
+		return
+	}
+	config.Govoice.Workspace = ws
+	if p.NumberPattern != "" {
+		config.Govoice.NumberPattern = p.NumberPattern
+		config.Govoice.NumberYearlyReset = p.NumberYearlyReset
+		config.Govoice.NumberSeries = p.NumberSeries
+	}
+	config.Profile = p.Name
+	activeProfile = &p
+	return
+}
+
+// apply sets the sender and the payment details of the profile in an invoice
+func (p *Profile) apply(i *Invoice) {
+	i.Profile = p.Name
+	if strings.TrimSpace(p.From.Name) != "" {
+		i.From = p.From
+	}
+	if strings.TrimSpace(p.PaymentDetails.Iban) != "" {
+		i.PaymentDetails = p.PaymentDetails
+	}
+}
+
+// resolveProfile selects the profile of the master descriptor if no profile is in use,
+// and sets its sender and payment details in the invoice
+func resolveProfile(i *Invoice) (err error) {
+	name := strings.TrimSpace(i.Profile)
+	switch {
+	case name == "" && activeProfile == nil:
+		return
+	case activeProfile == nil:
+		// only the workspace is switched, the master descriptor is the one already read
+		if _, err = selectProfile(name); err != nil {
+			return
+		}
+		fmt.Println("using the profile", name, "with workspace", config.Govoice.Workspace)
+	case name != "" && name != activeProfile.Name:
+		return fmt.Errorf("the master descriptor is for the profile %s, not for %s", name, activeProfile.Name)
+	}
+	activeProfile.apply(i)
+	return
+}
@@ -0,0 +1,93 @@
+package invoice
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+func TestProfiles(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	if _, _, err := Setup(tmpWorkspace); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	defer func() { activeProfile, config.Profile = nil, "" }()
+
+	if names, err := ListProfiles(); err != nil || len(names) != 0 {
+		t.Error("expected", 0, "found", names, err)
+	}
+	if _, err := AddProfile(Profile{Name: "My GmbH"}); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+	p := Profile{Name: "gmbh", Template: "gmbh", NumberPattern: "GMBH-{YYYY}-{SEQ:3}", NumberYearlyReset: true,
+		NumberSeries: map[string]string{"credit": "GMBH-CN-"}}
+	if _, err := AddProfile(p); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if _, err := AddProfile(p); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+	if _, err := AddProfile(Profile{Name: "freelance", Workspace: "side"}); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if names, err := ListProfiles(); err != nil || len(names) != 2 || names[0] != "freelance" || names[1] != "gmbh" {
+		t.Error("expected", "[freelance gmbh]", "found", names, err)
+	}
+	// the sender is the one of the master descriptor
+	read, err := ReadProfile("gmbh")
+	if err != nil || read.From != masterInvoice().From || read.NumberSeries["credit"] != "GMBH-CN-" || !read.NumberYearlyReset {
+		t.Error("unexpected profile", read, err)
+	}
+	if _, err = ReadProfile("missing"); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+
+	// the profile selected by the master descriptor, only the workspace and the index are switched
+	masterDescriptor := config.Govoice.MasterDescriptor
+	i := masterInvoice()
+	i.Profile = "freelance"
+	if err = resolveProfile(&i); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if ws := path.Join(tmpWorkspace, "side"); config.Govoice.Workspace != ws || config.Profile != "freelance" {
+		t.Error("expected", ws, "found", config.Govoice.Workspace, config.Profile)
+	}
+	if config.Govoice.MasterDescriptor != masterDescriptor {
+		t.Error("expected", masterDescriptor, "found", config.Govoice.MasterDescriptor)
+	}
+	if ip, _ := config.GetSearchIndexFilePath(); path.Base(ip) != "index.freelance.bleve" {
+		t.Error("expected", "index.freelance.bleve", "found", ip)
+	}
+	// the master descriptor of the profile is not created
+	if config.FileExists(path.Join(tmpWorkspace, "side", "_master.json")) {
+		t.Error("unexpected master descriptor of the profile")
+	}
+	i.Profile = "gmbh"
+	if err = resolveProfile(&i); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+
+	// the profile selected with --profile
+	activeProfile, config.Govoice.Workspace, config.Govoice.MasterDescriptor = nil, tmpWorkspace, "_master"
+	if _, err = UseProfile("gmbh"); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if ws := path.Join(tmpWorkspace, "gmbh"); config.Govoice.Workspace != ws || config.Govoice.NumberPattern != p.NumberPattern {
+		t.Error("expected", ws, p.NumberPattern, "found", config.Govoice.Workspace, config.Govoice.NumberPattern)
+	}
+	// the master descriptor of the profile is created
+	if !config.FileExists(path.Join(tmpWorkspace, "gmbh", "_master.json")) {
+		t.Error("missing master descriptor of the profile")
+	}
+	i = masterInvoice()
+	i.From = Recipient{Name: "Another Sender"}
+	if err = resolveProfile(&i); err != nil || i.Profile != "gmbh" || i.From != read.From {
+		t.Error("unexpected invoice", i.Profile, i.From, err)
+	}
+	if tp, err := invoiceTemplatePath(nil, "default.toml"); err == nil {
+		t.Error("expected missing template", "found", tp)
+	}
+}
@@ -0,0 +1,360 @@
+package invoice
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"gitlab.com/almost_cc/govoice/config"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Errors returned when decrypting a descriptor encrypted for recipients
+var (
+	ErrNoMatchingIdentity = errors.New("the invoice descriptor is not encrypted for any of the identities")
+	ErrInvalidKey         = errors.New("invalid key")
+)
+
+// A descriptor encrypted for recipients (envelope version 2) is encrypted with a
+// random file key, the file key is wrapped for each recipient public key (X25519).
+// Adding or removing a recipient requires only to rewrite the header.
+//
+//	magic       6 bytes  "GVDESC"
+//	version     1 byte   2
+//	cipher      1 byte   AEAD used to encrypt the payload and the file keys
+//	recipients  2 bytes  number of recipients
+//	stanzas     80 bytes for each recipient: ephemeral public key (32) and wrapped file key (48)
+//	nonce       12 bytes AEAD nonce of the payload
+//	mac         32 bytes HMAC-SHA256 of the header fields above, keyed with the file key
+//
+// the payload is encrypted with a key derived from the file key and the nonce.
+const (
+	envelopeVersion2 = 2
+
+	x25519KeySize       = 32
+	fileKeySize         = 32
+	wrappedFileKeySize  = fileKeySize + 16
+	recipientStanzaSize = x25519KeySize + wrappedFileKeySize
+
+	publicKeyPrefix = "GVPUB-"
+	secretKeyPrefix = "GVSECRET-"
+
+	hkdfInfoWrap    = "govoice X25519"
+	hkdfInfoHeader  = "govoice header"
+	hkdfInfoPayload = "govoice payload"
+)
+
+// recipientStanza is the file key wrapped for a recipient
+type recipientStanza struct {
+	EphemeralKey [x25519KeySize]byte
+	WrappedKey   []byte
+}
+
+// recipientsHeader is the header of a descriptor encrypted for recipients
+type recipientsHeader struct {
+	Stanzas []recipientStanza
+	Nonce   []byte
+	Mac     []byte
+}
+
+// prefix returns the header fields covered by the mac
+func (h *recipientsHeader) prefix() []byte {
+	var b bytes.Buffer
+	b.WriteString(envelopeMagic)
+	b.Write([]byte{envelopeVersion2, cipherAES256GCM})
+	binary.Write(&b, binary.BigEndian, uint16(len(h.Stanzas)))
+	for _, s := range h.Stanzas {
+		b.Write(s.EphemeralKey[:])
+		b.Write(s.WrappedKey)
+	}
+	b.Write(h.Nonce)
+	return b.Bytes()
+}
+
+// parseRecipientsHeader reads the header of a descriptor encrypted for recipients,
+// returns the header and the encrypted payload
+func parseRecipientsHeader(data []byte) (h recipientsHeader, payload []byte, err error) {
+	fixed := len(envelopeMagic) + 4
+	if envelopeVersion(data) != envelopeVersion2 || len(data) < fixed || data[len(envelopeMagic)+1] != cipherAES256GCM {
+		err = ErrUnsupportedDescriptorFormat
+		return
+	}
+	n := int(binary.BigEndian.Uint16(data[len(envelopeMagic)+2:]))
+	p := data[fixed:]
+	if n == 0 || len(p) < n*recipientStanzaSize+envelopeNonceSize+sha256.Size {
+		err = ErrUnsupportedDescriptorFormat
+		return
+	}
+	for i := 0; i < n; i++ {
+		var s recipientStanza
+		copy(s.EphemeralKey[:], p[:x25519KeySize])
+		s.WrappedKey, p = p[x25519KeySize:recipientStanzaSize], p[recipientStanzaSize:]
+		h.Stanzas = append(h.Stanzas, s)
+	}
+	h.Nonce, p = p[:envelopeNonceSize], p[envelopeNonceSize:]
+	h.Mac, payload = p[:sha256.Size], p[sha256.Size:]
+	return
+}
+
+// GenerateIdentity creates a new X25519 key pair, returns the encoded secret and public keys
+func GenerateIdentity() (secret, public string, err error) {
+	var s [x25519KeySize]byte
+	if _, err = io.ReadFull(rand.Reader, s[:]); err != nil {
+		return
+	}
+	var p [x25519KeySize]byte
+	curve25519.ScalarBaseMult(&p, &s)
+	return encodeKey(secretKeyPrefix, s), encodeKey(publicKeyPrefix, p), nil
+}
+
+// PublicKey returns the encoded public key of an encoded secret key
+func PublicKey(secret string) (public string, err error) {
+	s, err := decodeKey(secretKeyPrefix, secret)
+	if err != nil {
+		return
+	}
+	var p [x25519KeySize]byte
+	curve25519.ScalarBaseMult(&p, &s)
+	return encodeKey(publicKeyPrefix, p), nil
+}
+
+// CreateIdentityFile generates a new identity and writes it to the identity file,
+// an existing identity file is never overwritten. Returns the public key of the identity
+func CreateIdentityFile() (public string, err error) {
+	identityPath, exists := config.GetIdentityFilePath()
+	if exists {
+		err = fmt.Errorf("identity file %s already exists", identityPath)
+		return
+	}
+	secret, public, err := GenerateIdentity()
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(path.Dir(identityPath), os.FileMode(0700)); err != nil {
+		return
+	}
+	f, err := os.OpenFile(identityPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(0600))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "# public key: %s\n%s\n", public, secret)
+	return
+}
+
+func encodeKey(prefix string, k [x25519KeySize]byte) string {
+	return prefix + base64.RawURLEncoding.EncodeToString(k[:])
+}
+
+func decodeKey(prefix, encoded string) (k [x25519KeySize]byte, err error) {
+	encoded = strings.TrimSpace(encoded)
+	if !strings.HasPrefix(encoded, prefix) {
+		err = ErrInvalidKey
+		return
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(encoded, prefix))
+	if err != nil || len(raw) != x25519KeySize {
+		err = ErrInvalidKey
+		return
+	}
+	copy(k[:], raw)
+	return
+}
+
+// readIdentities reads the secret keys from the identity file, one key per line,
+// empty lines and lines starting with # are ignored
+func readIdentities() (identities [][x25519KeySize]byte, err error) {
+	identityPath, exists := config.GetIdentityFilePath()
+	if !exists {
+		err = fmt.Errorf("identity file %s not found, run govoice keygen to create one", identityPath)
+		return
+	}
+	f, err := os.Open(identityPath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, kerr := decodeKey(secretKeyPrefix, line)
+		if kerr != nil {
+			err = fmt.Errorf("invalid identity in %s", identityPath)
+			return
+		}
+		identities = append(identities, k)
+	}
+	if err = scanner.Err(); err == nil && len(identities) == 0 {
+		err = fmt.Errorf("no identities found in %s", identityPath)
+	}
+	return
+}
+
+// hkdfKey derives a key with HKDF-SHA256
+func hkdfKey(secret, salt []byte, info string) []byte {
+	k := make([]byte, fileKeySize)
+	io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), k)
+	return k
+}
+
+// x25519 computes the shared secret, rejecting the low order points
+func x25519(scalar, point *[x25519KeySize]byte) ([]byte, error) {
+	var shared, zero [x25519KeySize]byte
+	curve25519.ScalarMult(&shared, scalar, point)
+	if subtle.ConstantTimeCompare(shared[:], zero[:]) == 1 {
+		return nil, ErrInvalidKey
+	}
+	return shared[:], nil
+}
+
+// wrapFileKey wraps the file key for a recipient using an ephemeral key pair
+func wrapFileKey(fileKey []byte, recipient *[x25519KeySize]byte) (s recipientStanza, err error) {
+	var ephemeral [x25519KeySize]byte
+	if _, err = io.ReadFull(rand.Reader, ephemeral[:]); err != nil {
+		return
+	}
+	curve25519.ScalarBaseMult(&s.EphemeralKey, &ephemeral)
+	shared, err := x25519(&ephemeral, recipient)
+	if err != nil {
+		return
+	}
+	aead, err := newGCM(hkdfKey(shared, append(s.EphemeralKey[:], recipient[:]...), hkdfInfoWrap))
+	if err != nil {
+		return
+	}
+	// the wrapping key is used only once, the nonce can be zero
+	s.WrappedKey = aead.Seal(nil, make([]byte, envelopeNonceSize), fileKey, nil)
+	return
+}
+
+// unwrapFileKey tries to unwrap the file key with the identities
+func unwrapFileKey(h *recipientsHeader, identities [][x25519KeySize]byte) ([]byte, error) {
+	for _, id := range identities {
+		var public [x25519KeySize]byte
+		curve25519.ScalarBaseMult(&public, &id)
+		for _, s := range h.Stanzas {
+			shared, err := x25519(&id, &s.EphemeralKey)
+			if err != nil {
+				continue
+			}
+			aead, err := newGCM(hkdfKey(shared, append(s.EphemeralKey[:], public[:]...), hkdfInfoWrap))
+			if err != nil {
+				return nil, err
+			}
+			if fileKey, err := aead.Open(nil, make([]byte, envelopeNonceSize), s.WrappedKey, nil); err == nil {
+				return fileKey, nil
+			}
+		}
+	}
+	return nil, ErrNoMatchingIdentity
+}
+
+// headerMac computes the mac of the header with the file key
+func headerMac(fileKey []byte, h *recipientsHeader) []byte {
+	mac := hmac.New(sha256.New, hkdfKey(fileKey, nil, hkdfInfoHeader))
+	mac.Write(h.prefix())
+	return mac.Sum(nil)
+}
+
+// wrapForRecipients builds the header for the recipients
+func wrapForRecipients(fileKey, nonce []byte, recipients []string) (h recipientsHeader, err error) {
+	if len(recipients) == 0 || len(recipients) > 0xffff {
+		err = errors.New("invalid number of recipients")
+		return
+	}
+	for _, r := range recipients {
+		pk, kerr := decodeKey(publicKeyPrefix, r)
+		if kerr != nil {
+			err = fmt.Errorf("invalid recipient public key '%s'", r)
+			return
+		}
+		var s recipientStanza
+		if s, err = wrapFileKey(fileKey, &pk); err != nil {
+			return
+		}
+		h.Stanzas = append(h.Stanzas, s)
+	}
+	h.Nonce = nonce
+	h.Mac = headerMac(fileKey, &h)
+	return
+}
+
+// sealForRecipients encrypts the plaintext for a list of recipient public keys
+func sealForRecipients(recipients []string, plaintext []byte) (data []byte, err error) {
+	fileKey := make([]byte, fileKeySize)
+	if _, err = io.ReadFull(rand.Reader, fileKey); err != nil {
+		return
+	}
+	nonce := make([]byte, envelopeNonceSize)
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return
+	}
+	h, err := wrapForRecipients(fileKey, nonce, recipients)
+	if err != nil {
+		return
+	}
+	aead, err := newGCM(hkdfKey(fileKey, nonce, hkdfInfoPayload))
+	if err != nil {
+		return
+	}
+	header := append(h.prefix(), h.Mac...)
+	return aead.Seal(header, nonce, plaintext, nil), nil
+}
+
+// openForIdentities decrypts a descriptor encrypted for recipients with the first identity that matches
+func openForIdentities(identities [][x25519KeySize]byte, data []byte) (plaintext []byte, err error) {
+	h, payload, fileKey, err := openRecipientsHeader(identities, data)
+	if err != nil {
+		return
+	}
+	aead, err := newGCM(hkdfKey(fileKey, h.Nonce, hkdfInfoPayload))
+	if err != nil {
+		return
+	}
+	if plaintext, err = aead.Open(nil, h.Nonce, payload, nil); err != nil {
+		err = ErrDescriptorTampered
+	}
+	return
+}
+
+// rewrapForRecipients replaces the recipients of a descriptor, the payload is not modified
+func rewrapForRecipients(identities [][x25519KeySize]byte, recipients []string, data []byte) ([]byte, error) {
+	h, payload, fileKey, err := openRecipientsHeader(identities, data)
+	if err != nil {
+		return nil, err
+	}
+	nh, err := wrapForRecipients(fileKey, h.Nonce, recipients)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(nh.prefix(), nh.Mac...), payload...), nil
+}
+
+// openRecipientsHeader parses and authenticate the header, returns the header, the payload and the file key
+func openRecipientsHeader(identities [][x25519KeySize]byte, data []byte) (h recipientsHeader, payload, fileKey []byte, err error) {
+	if h, payload, err = parseRecipientsHeader(data); err != nil {
+		return
+	}
+	if fileKey, err = unwrapFileKey(&h, identities); err != nil {
+		return
+	}
+	if !hmac.Equal(h.Mac, headerMac(fileKey, &h)) {
+		err = ErrDescriptorTampered
+	}
+	return
+}
@@ -0,0 +1,168 @@
+package invoice
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+func TestSealForRecipients(t *testing.T) {
+	s1, p1, _ := GenerateIdentity()
+	s2, p2, _ := GenerateIdentity()
+	s3, _, _ := GenerateIdentity()
+	id1, _ := decodeKey(secretKeyPrefix, s1)
+	id2, _ := decodeKey(secretKeyPrefix, s2)
+	id3, _ := decodeKey(secretKeyPrefix, s3)
+
+	if pk, err := PublicKey(s1); err != nil || pk != p1 {
+		t.Error("expected", p1, "found", pk, err)
+	}
+
+	plaintext := []byte(`{"invoice":{"number":"0001"}}`)
+	data, err := sealForRecipients([]string{p1, p2}, plaintext)
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if v := envelopeVersion(data); v != envelopeVersion2 {
+		t.Error("expected", envelopeVersion2, "found", v)
+	}
+
+	// every recipient can decrypt
+	for _, ids := range [][][x25519KeySize]byte{{id1}, {id2}, {id3, id2}} {
+		out, err := openForIdentities(ids, data)
+		if err != nil {
+			t.Error("unexpected", err, "as error")
+		}
+		if !bytes.Equal(out, plaintext) {
+			t.Error("expected", string(plaintext), "found", string(out))
+		}
+	}
+
+	if _, err = openForIdentities([][x25519KeySize]byte{id3}, data); err != ErrNoMatchingIdentity {
+		t.Error("expected", ErrNoMatchingIdentity, "found", err)
+	}
+
+	// tamper the payload
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err = openForIdentities([][x25519KeySize]byte{id1}, tampered); err != ErrDescriptorTampered {
+		t.Error("expected", ErrDescriptorTampered, "found", err)
+	}
+	// tamper the header nonce
+	tampered = append([]byte{}, data...)
+	tampered[len(envelopeMagic)+4+2*recipientStanzaSize] ^= 1
+	if _, err = openForIdentities([][x25519KeySize]byte{id1}, tampered); err != ErrDescriptorTampered {
+		t.Error("expected", ErrDescriptorTampered, "found", err)
+	}
+
+	if _, err = sealForRecipients([]string{"GVPUB-invalid"}, plaintext); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+}
+
+func TestRewrapForRecipients(t *testing.T) {
+	s1, p1, _ := GenerateIdentity()
+	s2, p2, _ := GenerateIdentity()
+	id1, _ := decodeKey(secretKeyPrefix, s1)
+	id2, _ := decodeKey(secretKeyPrefix, s2)
+
+	plaintext := []byte(`{"invoice":{"number":"0001"}}`)
+	data, _ := sealForRecipients([]string{p1, p2}, plaintext)
+	_, payload, _ := parseRecipientsHeader(data)
+
+	// remove the second recipient
+	rewrapped, err := rewrapForRecipients([][x25519KeySize]byte{id2}, []string{p1}, data)
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	_, newPayload, _ := parseRecipientsHeader(rewrapped)
+	if !bytes.Equal(payload, newPayload) {
+		t.Error("the payload should not change")
+	}
+	if _, err = openForIdentities([][x25519KeySize]byte{id2}, rewrapped); err != ErrNoMatchingIdentity {
+		t.Error("expected", ErrNoMatchingIdentity, "found", err)
+	}
+	if out, err := openForIdentities([][x25519KeySize]byte{id1}, rewrapped); err != nil || !bytes.Equal(out, plaintext) {
+		t.Error("expected", string(plaintext), "found", string(out), err)
+	}
+}
+
+func TestRewrapWorkspace(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	identityPath := path.Join(tmpHome, "identity.txt")
+	config.Govoice = config.MainConfig{Workspace: tmpWorkspace, MasterDescriptor: "_master", IdentityFile: identityPath}
+
+	writeTestDescriptors(t, "password", "0001", "0002")
+
+	public, err := CreateIdentityFile()
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if _, err = CreateIdentityFile(); err == nil {
+		t.Error("the identity file should not be overwritten")
+	}
+	_, other, _ := GenerateIdentity()
+
+	// no recipients configured
+	if _, err = RewrapWorkspace("password"); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+
+	config.Govoice.Recipients = []string{public, other}
+	if needs, _ := WorkspaceNeedsPassword(); !needs {
+		t.Error("expected", true, "found", needs)
+	}
+	// the descriptors encrypted with the password still need it before the rewrap
+	os.Setenv(config.PasswordEnvVar, "password")
+	if p, err := ReadPassword(""); p != "password" || err != nil {
+		t.Error("expected", "password", "found", p, err)
+	}
+	os.Unsetenv(config.PasswordEnvVar)
+	count, err := RewrapWorkspace("password")
+	if err != nil || count != 2 {
+		t.Error("expected", 2, nil, "found", count, err)
+	}
+	if needs, _ := WorkspaceNeedsPassword(); needs {
+		t.Error("expected", false, "found", needs)
+	}
+	if p, err := ReadPassword(""); p != "" || err != nil {
+		t.Error("expected", "", "found", p, err)
+	}
+
+	// new descriptors are encrypted for the recipients, no password needed
+	writeTestDescriptors(t, "", "0003")
+	for _, n := range []string{"0001", "0002", "0003"} {
+		p, _ := config.GetInvoiceJsonPath(n)
+		i, err := readInvoiceDescriptorEncrypted(p, "")
+		if err != nil {
+			t.Error("unexpected", err, "as error")
+		}
+		if i.Invoice.Number != n {
+			t.Error("expected", n, "found", i.Invoice.Number)
+		}
+	}
+
+	// remove our key, the descriptors are not readable anymore
+	config.Govoice.Recipients = []string{other}
+	if count, err = RewrapWorkspace(""); err != nil || count != 3 {
+		t.Error("expected", 3, nil, "found", count, err)
+	}
+	p, _ := config.GetInvoiceJsonPath("0001")
+	if _, err = readInvoiceDescriptorEncrypted(p, ""); err != ErrNoMatchingIdentity {
+		t.Error("expected", ErrNoMatchingIdentity, "found", err)
+	}
+
+	// the identity file is private
+	if fi, _ := os.Stat(identityPath); fi.Mode().Perm() != 0600 {
+		t.Error("expected", os.FileMode(0600), "found", fi.Mode().Perm())
+	}
+	content, _ := ioutil.ReadFile(identityPath)
+	if !bytes.Contains(content, []byte(public)) {
+		t.Error("the identity file should contain the public key")
+	}
+}
@@ -0,0 +1,252 @@
+package invoice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+// ErrRekeyInterrupted is returned when a previous rekey has not been completed nor rolled back
+var ErrRekeyInterrupted = errors.New("a previous password change was interrupted, roll it back first")
+
+// RekeyOptions are the options to re-encrypt the descriptors of the workspace
+type RekeyOptions struct {
+	// key derivation parameters, when 0 the ones in the configuration are used
+	KdfCost            int
+	KdfBlockSize       int
+	KdfParallelization int
+	// EnvelopeVersion of the re-encrypted descriptors, when 0 the latest is used
+	EnvelopeVersion int
+}
+
+// kdfParams returns the key derivation parameters to use for the re-encryption
+func (o *RekeyOptions) kdfParams() (k kdfParams, err error) {
+	if o.EnvelopeVersion == envelopeVersion2 {
+		err = errors.New("envelope version 2 is for recipients, use rewrap to encrypt for recipients")
+		return
+	}
+	if o.EnvelopeVersion != 0 && o.EnvelopeVersion != envelopeVersion1 {
+		err = fmt.Errorf("unsupported envelope version %d", o.EnvelopeVersion)
+		return
+	}
+	return currentKdfParams().with(o.KdfCost, o.KdfBlockSize, o.KdfParallelization)
+}
+
+// rekeyJournal lists the descriptors that are being re-encrypted,
+// the original version of each one is copied in the journal folder
+type rekeyJournal struct {
+	Started time.Time `json:"started"`
+	Files   []string  `json:"files"`
+}
+
+// RekeyWorkspace decrypts all the descriptors of the workspace with the old password
+// and encrypts them with the new one. Nothing is modified if any of the descriptors cannot
+// be decrypted. The original descriptors are kept in a journal until all the descriptors
+// are re-encrypted, if the process fails or is interrupted they can be restored with RollbackRekey.
+// The payment ledger is re-encrypted together with the descriptors.
+// Returns the number of files re-encrypted
+func RekeyWorkspace(oldPassword, newPassword string, opts RekeyOptions) (count int, err error) {
+	if usingRecipients() {
+		err = errors.New("the descriptors are encrypted for recipients, use rewrap to change them")
+		return
+	}
+	params, err := opts.kdfParams()
+	if err != nil {
+		return
+	}
+	return rewriteDescriptors(func(data []byte) ([]byte, error) {
+		plaintext, err := decryptDescriptor(oldPassword, data)
+		if err != nil {
+			return nil, err
+		}
+		return sealEnvelope(newPassword, plaintext, params)
+	})
+}
+
+// RewrapWorkspace encrypts all the descriptors of the workspace for the recipients in the
+// configuration. The descriptors already encrypted for recipients get only a new header,
+// the others are decrypted with the password and encrypted again.
+// Like RekeyWorkspace the descriptors are journaled and can be restored with RollbackRekey.
+// Returns the number of descriptors rewritten
+func RewrapWorkspace(password string) (count int, err error) {
+	if !usingRecipients() {
+		err = errors.New("no recipients in the configuration")
+		return
+	}
+	var identities [][x25519KeySize]byte
+	return rewriteDescriptors(func(data []byte) ([]byte, error) {
+		if envelopeVersion(data) != envelopeVersion2 {
+			plaintext, err := decryptDescriptor(password, data)
+			if err != nil {
+				return nil, err
+			}
+			return sealForRecipients(config.Govoice.Recipients, plaintext)
+		}
+		if identities == nil {
+			ids, err := readIdentities()
+			if err != nil {
+				return nil, err
+			}
+			identities = ids
+		}
+		return rewrapForRecipients(identities, config.Govoice.Recipients, data)
+	})
+}
+
+// WorkspaceNeedsPassword tells if there are descriptors in the workspace encrypted with a password
+func WorkspaceNeedsPassword() (bool, error) {
+	names, err := encryptedFiles()
+	if err != nil {
+		return false, err
+	}
+	for _, n := range names {
+		data, err := ioutil.ReadFile(path.Join(config.Govoice.Workspace, n))
+		if err != nil {
+			return false, err
+		}
+		if envelopeVersion(data) != envelopeVersion2 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// rewriteDescriptors replaces the content of every encrypted descriptor in the workspace with
+// the output of the transform function. All the descriptors are transformed before writing any
+// of them, and the originals are journaled until all of them are written.
+// Returns the number of descriptors rewritten
+func rewriteDescriptors(transform func(data []byte) ([]byte, error)) (count int, err error) {
+	if _, exists := config.GetRekeyJournalPath(); exists {
+		err = ErrRekeyInterrupted
+		return
+	}
+
+	names, err := encryptedFiles()
+	if err != nil {
+		return
+	}
+	// transform everything before touching any file
+	originals := make([][]byte, len(names))
+	contents := make([][]byte, len(names))
+	for i, n := range names {
+		if originals[i], err = ioutil.ReadFile(path.Join(config.Govoice.Workspace, n)); err != nil {
+			return
+		}
+		if contents[i], err = transform(originals[i]); err != nil {
+			err = fmt.Errorf("cannot process %s: %v", n, err)
+			return
+		}
+	}
+
+	if err = writeRekeyJournal(names, originals); err != nil {
+		return
+	}
+
+	for i, n := range names {
+		if err = writeFileAtomic(path.Join(config.Govoice.Workspace, n), contents[i]); err != nil {
+			err = fmt.Errorf("error writing %s: %v", n, err)
+			if _, rerr := RollbackRekey(); rerr != nil {
+				err = fmt.Errorf("%v, rollback failed: %v", err, rerr)
+			}
+			return
+		}
+		count++
+	}
+
+	// all done, drop the journal
+	journalPath, _ := config.GetRekeyJournalPath()
+	err = os.RemoveAll(journalPath)
+	return
+}
+
+// RollbackRekey restores the descriptors saved in the journal of an interrupted rekey.
+// Returns true if the descriptors have been restored
+func RollbackRekey() (restored bool, err error) {
+	journalPath, exists := config.GetRekeyJournalPath()
+	if !exists {
+		// without the journal file the backup was not completed
+		// and the descriptors have not been modified
+		err = os.RemoveAll(journalPath)
+		return
+	}
+	rawData, err := ioutil.ReadFile(path.Join(journalPath, config.RekeyJournalFileName))
+	if err != nil {
+		return
+	}
+	var j rekeyJournal
+	if err = json.Unmarshal(rawData, &j); err != nil {
+		return
+	}
+	for _, n := range j.Files {
+		var content []byte
+		if content, err = ioutil.ReadFile(path.Join(journalPath, n)); err != nil {
+			return
+		}
+		descriptorPath := path.Join(config.Govoice.Workspace, n)
+		if err = writeFileAtomic(descriptorPath, content); err != nil {
+			return
+		}
+		os.Remove(descriptorPath + ".tmp")
+	}
+	restored = true
+	err = os.RemoveAll(journalPath)
+	return
+}
+
+// writeRekeyJournal copies the original descriptors in the journal folder,
+// the journal file is written last, once all the copies are on disk
+func writeRekeyJournal(names []string, originals [][]byte) (err error) {
+	journalPath, _ := config.GetRekeyJournalPath()
+	// leftovers of an incomplete backup
+	if err = os.RemoveAll(journalPath); err != nil {
+		return
+	}
+	if err = os.MkdirAll(journalPath, os.FileMode(0770)); err != nil {
+		return
+	}
+	for i, n := range names {
+		if err = writeFileAtomic(path.Join(journalPath, n), originals[i]); err != nil {
+			return
+		}
+	}
+	content, err := json.MarshalIndent(rekeyJournal{Started: time.Now(), Files: names}, "", "  ")
+	if err != nil {
+		return
+	}
+	return writeFileAtomic(path.Join(journalPath, config.RekeyJournalFileName), content)
+}
+
+// encryptedFiles returns the file names of the encrypted descriptors,
+// of the payment ledger and of the customer registry in the workspace
+func encryptedFiles() (names []string, err error) {
+	if names, err = encryptedDescriptors(); err != nil {
+		return
+	}
+	if ledgerPath, exists := config.GetPaymentLedgerPath(); exists {
+		names = append(names, path.Base(ledgerPath))
+	}
+	if registryPath, exists := config.GetCustomerRegistryPath(); exists {
+		names = append(names, path.Base(registryPath))
+	}
+	return
+}
+
+// encryptedDescriptors returns the file names of the encrypted descriptors in the workspace
+func encryptedDescriptors() (names []string, err error) {
+	files, err := ioutil.ReadDir(config.Govoice.Workspace)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		if !f.IsDir() && path.Ext(f.Name()) == config.ExtCfb {
+			names = append(names, f.Name())
+		}
+	}
+	return
+}
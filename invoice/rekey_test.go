@@ -0,0 +1,107 @@
+package invoice
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+func writeTestDescriptors(t *testing.T, password string, numbers ...string) {
+	cwd, _ := os.Getwd()
+	i, err := readInvoiceDescriptor(path.Join(cwd, "_testresources", "0001.json"))
+	if err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	for _, n := range numbers {
+		i.Invoice.Number = n
+		p, _ := config.GetInvoiceJsonPath(n)
+		if err = writeInvoiceDescriptorEncrypted(&i, p, password); err != nil {
+			t.Fatal("unexpected", err, "as error")
+		}
+	}
+}
+
+func TestRekeyWorkspace(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	config.Govoice = config.MainConfig{Workspace: tmpWorkspace, MasterDescriptor: "_master"}
+
+	writeTestDescriptors(t, "old password", "0001", "0002", "0003")
+
+	// wrong password, nothing is modified
+	if _, err := RekeyWorkspace("wrong password", "new password", RekeyOptions{}); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+
+	count, err := RekeyWorkspace("old password", "new password", RekeyOptions{KdfCost: 5})
+	if err != nil {
+		t.Error("unexpected", err, "as error")
+	}
+	if count != 3 {
+		t.Error("expected", 3, "found", count)
+	}
+	if jp, exists := config.GetRekeyJournalPath(); exists || config.FileExists(jp) {
+		t.Error("journal", jp, "should not exists")
+	}
+
+	for _, n := range []string{"0001", "0002", "0003"} {
+		p, _ := config.GetInvoiceJsonPath(n)
+		if _, err = readInvoiceDescriptorEncrypted(p, "old password"); err != ErrInvalidPassword {
+			t.Error("expected", ErrInvalidPassword, "found", err)
+		}
+		i, err := readInvoiceDescriptorEncrypted(p, "new password")
+		if err != nil {
+			t.Error("unexpected", err, "as error")
+		}
+		if i.Invoice.Number != n {
+			t.Error("expected", n, "found", i.Invoice.Number)
+		}
+	}
+
+	if _, err = RekeyWorkspace("new password", "x", RekeyOptions{EnvelopeVersion: 99}); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+}
+
+func TestRollbackRekey(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	config.Govoice = config.MainConfig{Workspace: tmpWorkspace, MasterDescriptor: "_master"}
+
+	writeTestDescriptors(t, "old password", "0001", "0002")
+
+	// nothing to roll back
+	if restored, err := RollbackRekey(); restored || err != nil {
+		t.Error("expected", false, nil, "found", restored, err)
+	}
+
+	// simulate a rekey interrupted after the first descriptor
+	names, _ := encryptedDescriptors()
+	var originals [][]byte
+	for _, n := range names {
+		content, _ := ioutil.ReadFile(path.Join(tmpWorkspace, n))
+		originals = append(originals, content)
+	}
+	if err := writeRekeyJournal(names, originals); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	writeTestDescriptors(t, "new password", "0001")
+
+	if _, err := RekeyWorkspace("old password", "new password", RekeyOptions{}); err != ErrRekeyInterrupted {
+		t.Error("expected", ErrRekeyInterrupted, "found", err)
+	}
+
+	restored, err := RollbackRekey()
+	if !restored || err != nil {
+		t.Error("expected", true, nil, "found", restored, err)
+	}
+	for _, n := range []string{"0001", "0002"} {
+		p, _ := config.GetInvoiceJsonPath(n)
+		if _, err = readInvoiceDescriptorEncrypted(p, "old password"); err != nil {
+			t.Error("unexpected", err, "as error")
+		}
+	}
+}
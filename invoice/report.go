@@ -0,0 +1,224 @@
+package invoice
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+// AgingBuckets are the ranges of days past the due date of the aging report
+var AgingBuckets = []string{"current", "1-30", "31-60", "61-90", "90+"}
+
+// AgingRow is the outstanding balance of a customer by days past the due date
+type AgingRow struct {
+	Customer string    `json:"customer"`
+	Invoices int       `json:"invoices"`
+	Buckets  []float64 `json:"buckets"`
+	Total    float64   `json:"total"`
+}
+
+// AgingReport is the accounts receivable aging report, the open invoices
+// grouped by customer and by days past the due date
+type AgingReport struct {
+	Date time.Time `json:"date"`
+	// Currency is the base currency of the amounts
+	Currency string     `json:"currency"`
+	Buckets  []string   `json:"bucket_labels"`
+	Rows     []AgingRow `json:"customers"`
+	Totals   AgingRow   `json:"totals"`
+}
+
+// agingBucket returns the bucket of an invoice due at due, at the date of the report
+func agingBucket(due, date time.Time) int {
+	days := int(startOfDay(date).Sub(startOfDay(due)).Hours() / 24)
+	switch {
+	case days <= 0:
+		return 0
+	case days <= 30:
+		return 1
+	case days <= 60:
+		return 2
+	case days <= 90:
+		return 3
+	}
+	return 4
+}
+
+// agingTotals sums the outstanding balances of a customer
+type agingTotals struct {
+	invoices int
+	buckets  []Money
+}
+
+func (a *agingTotals) add(bucket int, outstanding Money) {
+	if a.buckets == nil {
+		a.buckets = make([]Money, len(AgingBuckets))
+	}
+	a.buckets[bucket] = a.buckets[bucket].Add(outstanding)
+	a.invoices++
+}
+
+func (a *agingTotals) row(customer string) AgingRow {
+	r := AgingRow{Customer: customer, Invoices: a.invoices, Buckets: make([]float64, len(AgingBuckets))}
+	var total Money
+	for i, m := range a.buckets {
+		r.Buckets[i] = m.Float64()
+		total = total.Add(m)
+	}
+	r.Total = total.Float64()
+	return r
+}
+
+// GetAgingReport builds the aging report at a date from the invoices in the search index issued up
+// to the date, the balances are computed from the payments and the credits of the ledger up to the date.
+// The invoices not paid and not credited are grouped by customer and by days past the due date
+func GetAgingReport(date time.Time, password string) (report AgingReport, err error) {
+	dates := bleve.NewDateRangeQuery(time.Time{}, startOfDay(date).AddDate(0, 0, 1))
+	dates.SetField(config.FieldDate)
+	entries, err := searchAllEntries(dates)
+	if err != nil {
+		return
+	}
+	ledger, err := ReadPaymentLedger(password)
+	if err != nil {
+		return
+	}
+	report = newAgingReport(ledger.unsettledAt(entries, date), date)
+	return
+}
+
+// newAgingReport groups the outstanding balances of the entries, in the base currency,
+// by customer and by days past the due date
+func newAgingReport(entries []InvoiceEntry, date time.Time) (report AgingReport) {
+	report = AgingReport{Date: date, Currency: BaseCurrency(), Buckets: AgingBuckets}
+	customers := make(map[string]*agingTotals)
+	var totals agingTotals
+	for _, ie := range entries {
+		outstanding := moneyFromFloat(ie.BaseOutstanding, "")
+		bucket := agingBucket(ie.Due, date)
+		c, exists := customers[ie.Customer]
+		if !exists {
+			c = &agingTotals{}
+			customers[ie.Customer] = c
+		}
+		c.add(bucket, outstanding)
+		totals.add(bucket, outstanding)
+	}
+	for name, c := range customers {
+		report.Rows = append(report.Rows, c.row(name))
+	}
+	sort.Slice(report.Rows, func(i, j int) bool { return report.Rows[i].Customer < report.Rows[j].Customer })
+	report.Totals = totals.row("")
+	return
+}
+
+// RevenueRow is the revenue of a period and/or of a customer
+type RevenueRow struct {
+	Period   string  `json:"period,omitempty"`
+	Customer string  `json:"customer,omitempty"`
+	Invoices int     `json:"invoices"`
+	Net      float64 `json:"net"`
+	Tax      float64 `json:"tax"`
+	Gross    float64 `json:"gross"`
+}
+
+// RevenueReport is the revenue of the invoices in a date range, grouped by period and/or by customer
+type RevenueReport struct {
+	From       time.Time    `json:"from"`
+	To         time.Time    `json:"to"`
+	Period     string       `json:"period,omitempty"`
+	ByCustomer bool         `json:"by_customer"`
+	Currency   string       `json:"currency"`
+	Rows       []RevenueRow `json:"rows"`
+	Totals     RevenueRow   `json:"totals"`
+}
+
+// revenueTotals sums the amounts of a group of invoices in the base currency
+type revenueTotals struct {
+	invoices int
+	net, tax Money
+}
+
+func (r *revenueTotals) add(ie *InvoiceEntry) {
+	r.invoices++
+	r.net = r.net.Add(moneyFromFloat(ie.BaseAmount, ""))
+	r.tax = r.tax.Add(moneyFromFloat(ie.BaseTax, ""))
+}
+
+func (r *revenueTotals) row(period, customer string) RevenueRow {
+	return RevenueRow{
+		Period:   period,
+		Customer: customer,
+		Invoices: r.invoices,
+		Net:      r.net.Float64(),
+		Tax:      r.tax.Float64(),
+		Gross:    r.net.Add(r.tax).Float64(),
+	}
+}
+
+// periodLabel returns the label of the period of a date (ex. 2026-03, 2026-Q1, 2026),
+// empty if the invoices are not grouped by period
+func periodLabel(date time.Time, period string) string {
+	switch period {
+	case config.PeriodMonth:
+		return date.Format("2006-01")
+	case config.PeriodQuarter:
+		return fmt.Sprintf("%d-Q%d", date.Year(), (int(date.Month())+2)/3)
+	case config.PeriodYear:
+		return date.Format("2006")
+	}
+	return ""
+}
+
+// GetRevenueReport builds the revenue report of the invoices in the search index dated between from and to
+// (inclusive), the net, tax and gross totals are grouped by period (month, quarter, year or none)
+// and/or by customer. The credit notes are subtracted from the revenue of their period
+func GetRevenueReport(from, to time.Time, period string, byCustomer bool) (report RevenueReport, err error) {
+	if period != config.PeriodNone && periodLabel(from, period) == "" {
+		err = fmt.Errorf("unknown period '%s', use month, quarter, year or none", period)
+		return
+	}
+	dates := bleve.NewDateRangeQuery(startOfDay(from), startOfDay(to).AddDate(0, 0, 1))
+	dates.SetField(config.FieldDate)
+	entries, err := searchAllEntries(dates)
+	if err != nil {
+		return
+	}
+	report = newRevenueReport(entries, from, to, period, byCustomer)
+	return
+}
+
+// newRevenueReport groups the amounts of the entries by period and/or by customer
+func newRevenueReport(entries []InvoiceEntry, from, to time.Time, period string, byCustomer bool) (report RevenueReport) {
+	report = RevenueReport{From: from, To: to, Period: period, ByCustomer: byCustomer, Currency: BaseCurrency()}
+	type groupKey struct{ period, customer string }
+	groups := make(map[groupKey]*revenueTotals)
+	var totals revenueTotals
+	for i := range entries {
+		k := groupKey{period: periodLabel(entries[i].Date, period)}
+		if byCustomer {
+			k.customer = entries[i].Customer
+		}
+		g, exists := groups[k]
+		if !exists {
+			g = &revenueTotals{}
+			groups[k] = g
+		}
+		g.add(&entries[i])
+		totals.add(&entries[i])
+	}
+	for k, g := range groups {
+		report.Rows = append(report.Rows, g.row(k.period, k.customer))
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		if report.Rows[i].Period != report.Rows[j].Period {
+			return report.Rows[i].Period < report.Rows[j].Period
+		}
+		return report.Rows[i].Customer < report.Rows[j].Customer
+	})
+	report.Totals = totals.row("", "")
+	return
+}
@@ -0,0 +1,243 @@
+package invoice
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+func TestAgingReport(t *testing.T) {
+	date := time.Date(2026, 10, 18, 10, 0, 0, 0, time.Local)
+	due := func(days int) time.Time {
+		return time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -days)
+	}
+	entries := []InvoiceEntry{
+		{Number: "1", Customer: "ACME", Due: due(-5), BaseOutstanding: 100},
+		{Number: "2", Customer: "ACME", Due: due(0), BaseOutstanding: 0.1},
+		{Number: "3", Customer: "ACME", Due: due(30), BaseOutstanding: 0.2},
+		{Number: "4", Customer: "Beta", Due: due(31), BaseOutstanding: 50},
+		{Number: "5", Customer: "Beta", Due: due(90), BaseOutstanding: 20},
+		{Number: "6", Customer: "Beta", Due: due(91), BaseOutstanding: 10.5},
+		{Number: "7", Customer: "Alpha", Due: due(400), BaseOutstanding: 1},
+	}
+	r := newAgingReport(entries, date)
+
+	expected := []AgingRow{
+		{Customer: "ACME", Invoices: 3, Buckets: []float64{100.1, 0.2, 0, 0, 0}, Total: 100.3},
+		{Customer: "Alpha", Invoices: 1, Buckets: []float64{0, 0, 0, 0, 1}, Total: 1},
+		{Customer: "Beta", Invoices: 3, Buckets: []float64{0, 0, 50, 20, 10.5}, Total: 80.5},
+	}
+	if !reflect.DeepEqual(r.Rows, expected) {
+		t.Error("expected", expected, "found", r.Rows)
+	}
+	totals := AgingRow{Invoices: 7, Buckets: []float64{100.1, 0.2, 50, 20, 11.5}, Total: 181.8}
+	if !reflect.DeepEqual(r.Totals, totals) {
+		t.Error("expected", totals, "found", r.Totals)
+	}
+
+	// no open invoices
+	r = newAgingReport(nil, date)
+	if len(r.Rows) != 0 || r.Totals.Total != 0 || len(r.Totals.Buckets) != len(AgingBuckets) {
+		t.Error("unexpected report", r)
+	}
+}
+
+func TestUnsettledAt(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 9, d, 0, 0, 0, 0, time.UTC) }
+	entries := []InvoiceEntry{
+		{Number: "1", Total: 100, BaseTotal: 100, ExchangeRate: 1},
+		{Number: "2", Total: 100, BaseTotal: 100, ExchangeRate: 1},
+		{Number: "3", Total: 100, BaseTotal: 100, ExchangeRate: 1},
+		{Number: "CN-1", Total: -100, BaseTotal: -100, ExchangeRate: 1},
+	}
+	l := PaymentLedger{
+		Payments: []Payment{
+			{Invoice: "1", Amount: moneyFromFloat(40, ""), Date: day(10)},
+			{Invoice: "1", Amount: moneyFromFloat(60, ""), Date: day(20)},
+			{Invoice: "2", Amount: moneyFromFloat(100, ""), Date: day(5)},
+		},
+		Credits: []Credit{{Invoice: "3", CreditNote: "CN-1", Date: day(15)}},
+	}
+	// the payments and the credits after the date are not considered
+	found := l.unsettledAt(entries, day(12))
+	if len(found) != 2 || found[0].Number != "1" || found[0].BaseOutstanding != 60 || found[1].Number != "3" || found[1].BaseOutstanding != 100 {
+		t.Error("unexpected entries", found)
+	}
+	if found = l.unsettledAt(entries, day(20)); len(found) != 0 {
+		t.Error("unexpected entries", found)
+	}
+	if found = l.unsettledAt(entries, day(1)); len(found) != 3 {
+		t.Error("expected", 3, "found", len(found))
+	}
+}
+
+func TestRevenueReport(t *testing.T) {
+	day := func(m time.Month, d int) time.Time { return time.Date(2026, m, d, 0, 0, 0, 0, time.UTC) }
+	entries := []InvoiceEntry{
+		{Number: "1", Customer: "ACME", Date: day(1, 10), BaseAmount: 100, BaseTax: 19},
+		{Number: "2", Customer: "Beta", Date: day(2, 10), BaseAmount: 200.1, BaseTax: 38.02},
+		{Number: "3", Customer: "ACME", Date: day(3, 31), BaseAmount: 0.2, BaseTax: 0.04},
+		{Number: "4", Customer: "ACME", Date: day(4, 1), BaseAmount: 50, BaseTax: 3.5},
+		// credit note of 1
+		{Number: "CN-1", Customer: "ACME", Date: day(4, 2), BaseAmount: -100, BaseTax: -19},
+	}
+	from, to := day(1, 1), day(12, 31)
+
+	r := newRevenueReport(entries, from, to, "quarter", false)
+	expected := []RevenueRow{
+		{Period: "2026-Q1", Invoices: 3, Net: 300.3, Tax: 57.06, Gross: 357.36},
+		{Period: "2026-Q2", Invoices: 2, Net: -50, Tax: -15.5, Gross: -65.5},
+	}
+	if !reflect.DeepEqual(r.Rows, expected) {
+		t.Error("expected", expected, "found", r.Rows)
+	}
+	totals := RevenueRow{Invoices: 5, Net: 250.3, Tax: 41.56, Gross: 291.86}
+	if !reflect.DeepEqual(r.Totals, totals) {
+		t.Error("expected", totals, "found", r.Totals)
+	}
+
+	r = newRevenueReport(entries, from, to, "year", true)
+	expected = []RevenueRow{
+		{Period: "2026", Customer: "ACME", Invoices: 4, Net: 50.2, Tax: 3.54, Gross: 53.74},
+		{Period: "2026", Customer: "Beta", Invoices: 1, Net: 200.1, Tax: 38.02, Gross: 238.12},
+	}
+	if !reflect.DeepEqual(r.Rows, expected) {
+		t.Error("expected", expected, "found", r.Rows)
+	}
+
+	// by customer only
+	r = newRevenueReport(entries, from, to, "none", true)
+	if len(r.Rows) != 2 || r.Rows[0].Period != "" || r.Rows[0].Customer != "ACME" {
+		t.Error("unexpected rows", r.Rows)
+	}
+
+	labels := map[string]string{"month": "2026-03", "quarter": "2026-Q1", "year": "2026", "none": ""}
+	for p, l := range labels {
+		if found := periodLabel(day(3, 31), p); found != l {
+			t.Error("expected", l, "found", found)
+		}
+	}
+	if _, err := GetRevenueReport(from, to, "week", false); err == nil {
+		t.Error("unexpected", nil, "as error")
+	}
+}
+
+func TestParseVatPeriod(t *testing.T) {
+	tests := []struct {
+		period   string
+		from, to string
+	}{
+		{"2026-Q3", "2026-07-01", "2026-09-30"},
+		{"2026-q1", "2026-01-01", "2026-03-31"},
+		{"2026-02", "2026-02-01", "2026-02-28"},
+		{"2026", "2026-01-01", "2026-12-31"},
+	}
+	for _, tt := range tests {
+		from, to, err := ParseVatPeriod(tt.period)
+		if err != nil {
+			t.Error("unexpected", err, "as error")
+		}
+		if f, l := from.Format("2006-01-02"), to.Format("2006-01-02"); f != tt.from || l != tt.to {
+			t.Error("expected", tt.from, tt.to, "found", f, l)
+		}
+	}
+	for _, p := range []string{"2026-Q5", "2026-13", "26-Q1", "Q3"} {
+		if _, _, err := ParseVatPeriod(p); err == nil {
+			t.Error("period", p, "should be invalid")
+		}
+	}
+}
+
+func TestVatReport(t *testing.T) {
+	seller := Recipient{Country: "Germany", VatNumber: "DE 123456789"}
+	customers := map[string]Recipient{
+		"domestic":  {Country: "Deutschland"},
+		"eu":        {Country: "Spain", VatNumber: "ES B12345678"},
+		"consumer":  {Country: "France"},
+		"export":    {Country: "Switzerland"},
+		"sameVat":   {Country: "DE", VatNumber: "DE999999999"},
+		"noCountry": {},
+	}
+	categories := map[string]string{
+		"domestic":  config.VatDomestic,
+		"eu":        config.VatIntraEU,
+		"consumer":  config.VatDomestic,
+		"export":    config.VatExport,
+		"sameVat":   config.VatDomestic,
+		"noCountry": config.VatDomestic,
+	}
+	for n, c := range customers {
+		if found := vatCategory(&seller, &c); found != categories[n] {
+			t.Error(n, "expected", categories[n], "found", found)
+		}
+	}
+
+	zero := 0.0
+	invoice := func(number string, to Recipient, items ...Item) Invoice {
+		return Invoice{
+			From:     seller,
+			To:       to,
+			Invoice:  InvoiceData{Number: number},
+			Settings: InvoiceSettings{VatRate: 19, TaxCategories: map[string]float64{"books": 7}},
+			Items:    &items,
+		}
+	}
+	invoices := []Invoice{
+		invoice("1", customers["domestic"], Item{Quantity: 1, Price: 100}, Item{Quantity: 1, Price: 10, TaxCategory: "books"}),
+		invoice("2", customers["consumer"], Item{Quantity: 2, Price: 50}),
+		invoice("3", customers["eu"], Item{Quantity: 1, Price: 300, TaxRate: &zero}),
+		invoice("4", customers["export"], Item{Quantity: 1, Price: 80, TaxRate: &zero}),
+		// credit note
+		invoice("5", customers["domestic"], Item{Quantity: -1, Price: 10, TaxCategory: "books"}),
+	}
+	r, err := newVatReport(invoices, time.Time{}, time.Time{}, &ExchangeRates{})
+	if err != nil {
+		t.Error("unexpected", err, "as error")
+	}
+	rows := []VatRow{
+		{Category: config.VatDomestic, Rate: 19, Invoices: 2, Net: 200, Tax: 38},
+		{Category: config.VatDomestic, Rate: 7, Invoices: 2, Net: 0, Tax: 0},
+		{Category: config.VatIntraEU, Rate: 0, Invoices: 1, Net: 300, Tax: 0},
+		{Category: config.VatExport, Rate: 0, Invoices: 1, Net: 80, Tax: 0},
+	}
+	if !reflect.DeepEqual(r.Rows, rows) {
+		t.Error("expected", rows, "found", r.Rows)
+	}
+	cats := []VatRow{
+		{Category: config.VatDomestic, Invoices: 3, Net: 200, Tax: 38},
+		{Category: config.VatIntraEU, Invoices: 1, Net: 300},
+		{Category: config.VatExport, Invoices: 1, Net: 80},
+	}
+	if !reflect.DeepEqual(r.Categories, cats) {
+		t.Error("expected", cats, "found", r.Categories)
+	}
+	if total := (VatRow{Invoices: 5, Net: 580, Tax: 38}); r.Total != total {
+		t.Error("expected", total, "found", r.Total)
+	}
+}
+
+func TestVatReportInvalidDate(t *testing.T) {
+	tmpHome, tmpWorkspace := makeTmpHome()
+	defer os.RemoveAll(tmpHome)
+	if _, _, err := Setup(tmpWorkspace); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	writeTestDescriptors(t, "password", "0001")
+	if _, err := GetVatReport("2017", "password"); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	// an invoice without a valid date is not silently reported at the current date
+	i := masterInvoice()
+	i.Invoice.Number, i.Invoice.Date = "0002", "2017-01-31"
+	p, _ := config.GetInvoiceJsonPath(i.Invoice.Number)
+	if err := writeInvoiceDescriptorEncrypted(&i, p, "password"); err != nil {
+		t.Fatal("unexpected", err, "as error")
+	}
+	if _, err := GetVatReport("2017", "password"); err == nil || !strings.Contains(err.Error(), "0002") {
+		t.Error("expected", "invalid date of 0002", "found", err)
+	}
+}
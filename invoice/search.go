@@ -10,6 +10,9 @@ import (
 	"time"
 
 	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search/query"
 	"gitlab.com/almost_cc/govoice/config"
 )
 
@@ -21,6 +24,8 @@ type InvoiceQuery struct {
 	Text     string
 	AmountGE float64
 	AmountLE float64
+	TaxRate  float64
+	Status   string
 	DateFrom time.Time
 	DateTo   time.Time
 }
@@ -49,6 +54,12 @@ func (q *InvoiceQuery) String() string {
 	if q.AmountLE != config.QueryDefaultAmountLE {
 		f = append(f, fmt.Sprint("amount < ", q.AmountLE))
 	}
+	if q.TaxRate != config.QueryDefaultTaxRate {
+		f = append(f, fmt.Sprint("tax rate = ", q.TaxRate))
+	}
+	if q.Status != config.QueryDefaultStatus {
+		f = append(f, fmt.Sprint("status = ", q.Status))
+	}
 	return strings.Join(f, " and ")
 }
 
@@ -57,8 +68,98 @@ type InvoiceEntry struct {
 	Number   string
 	Customer string
 	Amount   float64
+	Tax      float64
+	Taxes    []TaxEntry
 	Date     time.Time
 	Text     string
+	// CreditNoteOf is the invoice credited by a credit note
+	CreditNoteOf string
+	// CreditedBy is the credit note of a credited invoice
+	CreditedBy string
+	// Status is the payment status, without considering the due date (never overdue)
+	Status      string
+	Due         time.Time
+	Total       float64
+	Paid        float64
+	Outstanding float64
+	// Currency is the currency of the amounts of the invoice, the base amounts are converted
+	// to the base currency at the date of the invoice with the exchange rate
+	Currency        string
+	ExchangeRate    float64
+	BaseAmount      float64
+	BaseTax         float64
+	BaseTotal       float64
+	BaseOutstanding float64
+}
+
+// setPaid updates the payment status of the entry with the amount paid
+func (ie *InvoiceEntry) setPaid(paid Money) {
+	total := moneyFromFloat(ie.Total, ie.Currency)
+	paid.Currency = ie.Currency
+	ie.Paid = paid.Float64()
+	ie.Outstanding = total.Sub(paid).Float64()
+	ie.Status = settlementStatus(total, paid, ie.CreditedBy)
+	c := conversion{factor: decimalRat(ie.ExchangeRate)}
+	ie.BaseOutstanding = moneyFromFloat(ie.BaseTotal, "").Sub(c.convert(paid)).Float64()
+}
+
+// CurrentStatus returns the payment status of the invoice, overdue if it is
+// not settled after the due date
+func (ie *InvoiceEntry) CurrentStatus() string {
+	return currentStatus(ie.Status, ie.Due, time.Now())
+}
+
+// TaxEntry is the tax of a tax rate indexed by bleve
+type TaxEntry struct {
+	Rate   float64
+	Base   float64
+	Amount float64
+}
+
+// newInvoiceEntry creates the index entry of an invoice, the amounts are
+// computed with the invoice rounding rules and converted for the index.
+// The base amounts are converted with the exchange rates at the date of the invoice
+func newInvoiceEntry(i *Invoice, date time.Time, rates *ExchangeRates) (ie InvoiceEntry, err error) {
+	c, err := rates.invoiceConversion(i)
+	if err != nil {
+		return
+	}
+	subtotal, total := i.GetTotals()
+	var tax Money
+	for _, t := range i.GetTaxes() {
+		tax = tax.Add(t.Amount)
+	}
+	// write the text in the bleve index
+	var fulldescr strings.Builder
+	if i.Items != nil {
+		for _, t := range *i.Items {
+			fulldescr.WriteString(strings.ToLower(t.Description))
+			fulldescr.WriteString(" ")
+		}
+	}
+	ie = InvoiceEntry{
+		Number:   i.Invoice.Number,
+		Customer: i.To.Name,
+		Amount:   subtotal.Float64(),
+		Tax:      tax.Float64(),
+		Date:     date,
+		Text:     fulldescr.String(),
+
+		CreditNoteOf: i.Invoice.CreditNoteOf,
+		Due:          invoiceDue(i),
+		Total:        total.Float64(),
+
+		Currency:     currencyOf(i.Settings.Currency),
+		ExchangeRate: c.Float64(),
+		BaseAmount:   c.convert(subtotal).Float64(),
+		BaseTax:      c.convert(tax).Float64(),
+		BaseTotal:    c.convert(total).Float64(),
+	}
+	ie.setPaid(Money{})
+	for _, t := range i.GetTaxes() {
+		ie.Taxes = append(ie.Taxes, TaxEntry{Rate: t.Rate, Base: t.Base.Float64(), Amount: t.Amount.Float64()})
+	}
+	return
 }
 
 // -------- exported functions --------
@@ -71,8 +172,10 @@ func DefaultInvoiceQuery() InvoiceQuery {
 		Text:     config.QueryDefaultText,
 		AmountGE: float64(config.QueryDefaultAmountGE),
 		AmountLE: float64(config.QueryDefaultAmountLE),
+		TaxRate:  config.QueryDefaultTaxRate,
 		DateFrom: df,
 		DateTo:   time.Now(),
+		Status:   config.QueryDefaultStatus,
 	}
 }
 
@@ -118,44 +221,67 @@ func RebuildSearchIndex(password string) (int, time.Duration, error) {
 	// create a new batch
 	b := index.NewBatch()
 
+	// the payments are needed for the payment status
+	ledger, err := ReadPaymentLedger(password)
+	if err != nil {
+		fmt.Println("error reading the payments:", err, ", the invoices will be indexed as unpaid")
+	}
+	// and the exchange rates for the base amounts
+	rates, err := ReadExchangeRates()
+	if err != nil {
+		return counter, elapsed, err
+	}
+
 	// scan the descriptor files
 	files, _ := ioutil.ReadDir(config.Govoice.Workspace)
 
+	// the credited invoices are marked after the scan
+	entries := make(map[string]InvoiceEntry)
+	credited := make(map[string]string)
+
 	counter = 0
 	for _, f := range files {
 		if path.Ext(f.Name()) == config.ExtCfb {
 			descriptorPath := path.Join(config.Govoice.Workspace, f.Name())
 			if invoice, err := readInvoiceDescriptorEncrypted(descriptorPath, password); err == nil {
 				// build the IndexEntry
-				amount, _ := invoice.GetTotals()
 				df := dateFormatToLayout(invoice.Settings.DateInputFormat)
 				invd, _ := time.Parse(df, invoice.Invoice.Date)
-				// write the text in the bleve index
-				var fulldescr strings.Builder
-				for _, t := range *invoice.Items {
-					fulldescr.WriteString(strings.ToLower(t.Description))
-					fulldescr.WriteString(" ")
-				}
-
-				ie := InvoiceEntry{
-					Number:   invoice.Invoice.Number,
-					Customer: invoice.To.Name,
-					Amount:   amount,
-					Date:     invd,
-					Text:     fulldescr.String(),
+				ie, err := newInvoiceEntry(&invoice, invd, &rates)
+				if err != nil {
+					fmt.Println("error indexing", f.Name(), ":", err, ", the invoice will not be searchable")
+					continue
 				}
+				ie.setPaid(ledger.Paid(ie.Number))
 				// add the invoice to the index
 				b.Index(invoice.Invoice.Number, ie)
+				entries[ie.Number] = ie
+				if ie.CreditNoteOf != "" {
+					credited[ie.CreditNoteOf] = ie.Number
+				}
 
 				counter++
 				if counter%100 == 0 {
 					index.Batch(b)
 				}
 			} else {
-				fmt.Println("error decrypting ", f.Name(), ", the invoice will not be searchable")
+				fmt.Println("error decrypting ", f.Name(), ":", err, ", the invoice will not be searchable")
 			}
 		}
 	}
+	// the credits of the ledger, for the credit notes not in the workspace
+	for _, c := range ledger.Credits {
+		if _, exists := credited[c.Invoice]; !exists {
+			credited[c.Invoice] = c.CreditNote
+		}
+	}
+	for number, creditNote := range credited {
+		if ie, exists := entries[number]; exists {
+			ie.CreditedBy = creditNote
+			ie.setPaid(ledger.Paid(number))
+			b.Index(number, ie)
+		}
+	}
 	index.Batch(b)
 	elapsed = time.Since(start)
 	docsCount, _ := index.DocCount()
@@ -200,7 +326,23 @@ func SearchInvoice(q InvoiceQuery) (entries []InvoiceEntry, found uint64, elapse
 	// add range on amount if necessary
 	if q.AmountLE != config.QueryDefaultAmountLE || q.AmountGE != config.QueryDefaultAmountGE {
 		subq := bleve.NewNumericRangeQuery(&q.AmountGE, &q.AmountLE)
-		subq.SetField(config.FieldAmount)
+		subq.SetField(config.FieldBaseAmount)
+		query.AddQuery(subq)
+	}
+	// match invoices with items at the tax rate
+	if q.TaxRate != config.QueryDefaultTaxRate {
+		inclusive := true
+		subq := bleve.NewNumericRangeInclusiveQuery(&q.TaxRate, &q.TaxRate, &inclusive, &inclusive)
+		subq.SetField(config.FieldTaxRate)
+		query.AddQuery(subq)
+	}
+	// match the payment status, the overdue invoices are the unsettled ones after the due date
+	if q.Status != config.QueryDefaultStatus {
+		subq, qerr := statusQuery(q.Status)
+		if qerr != nil {
+			err = qerr
+			return
+		}
 		query.AddQuery(subq)
 	}
 	// add range query on date
@@ -217,7 +359,7 @@ func SearchInvoice(q InvoiceQuery) (entries []InvoiceEntry, found uint64, elapse
 	}
 
 	search := bleve.NewSearchRequest(query)
-	search.Fields = []string{config.FieldNumber, config.FieldCustomer, config.FieldAmount, config.FieldDate}
+	search.Fields = entryFields
 	search.SortBy([]string{"-" + config.FieldDate, config.FieldNumber})
 	search.Size = 50
 	results, err := index.Search(search)
@@ -226,19 +368,14 @@ func SearchInvoice(q InvoiceQuery) (entries []InvoiceEntry, found uint64, elapse
 		return
 	}
 
-	// record also the total amount
+	// record also the total amount in the base currency, summed in minor units
+	var sum Money
 	for _, res := range results.Hits {
-
-		d, _ := time.Parse(time.RFC3339, res.Fields[config.FieldDate].(string))
-		amount += res.Fields[config.FieldAmount].(float64)
-		ie := InvoiceEntry{
-			Number:   res.Fields[config.FieldNumber].(string),
-			Customer: res.Fields[config.FieldCustomer].(string),
-			Amount:   res.Fields[config.FieldAmount].(float64),
-			Date:     d,
-		}
+		ie := entryFromFields(res.Fields)
+		sum = sum.Add(moneyFromFloat(ie.BaseAmount, ""))
 		entries = append(entries, ie)
 	}
+	amount = sum.Float64()
 	found = results.Total
 	elapsed = results.Took
 	return
@@ -246,6 +383,100 @@ func SearchInvoice(q InvoiceQuery) (entries []InvoiceEntry, found uint64, elapse
 
 // -------- private methods ---------
 
+// entryFields are the fields of the index entries returned by the searches
+var entryFields = []string{config.FieldNumber, config.FieldCustomer, config.FieldAmount, config.FieldTax, config.FieldDate,
+	config.FieldStatus, config.FieldDue, config.FieldTotal, config.FieldPaid, config.FieldOutstanding,
+	config.FieldCurrency, config.FieldBaseAmount, config.FieldBaseTax, config.FieldBaseTotal, config.FieldBaseOutstanding}
+
+//entryFromFields build an index entry from the stored fields of a search hit
+func entryFromFields(fields map[string]interface{}) InvoiceEntry {
+	// the fields missing in the indexes built by older versions are zero
+	number, _ := fields[config.FieldNumber].(string)
+	customer, _ := fields[config.FieldCustomer].(string)
+	amount, _ := fields[config.FieldAmount].(float64)
+	tax, _ := fields[config.FieldTax].(float64)
+	dateValue, _ := fields[config.FieldDate].(string)
+	date, _ := time.Parse(time.RFC3339, dateValue)
+	status, _ := fields[config.FieldStatus].(string)
+	dueValue, _ := fields[config.FieldDue].(string)
+	due, _ := time.Parse(time.RFC3339, dueValue)
+	total, _ := fields[config.FieldTotal].(float64)
+	paid, _ := fields[config.FieldPaid].(float64)
+	outstanding, _ := fields[config.FieldOutstanding].(float64)
+	currency, _ := fields[config.FieldCurrency].(string)
+	// the indexes built before the currencies have the amounts in the base currency
+	if currency == "" {
+		currency = BaseCurrency()
+	}
+	baseAmount, exists := fields[config.FieldBaseAmount].(float64)
+	if !exists {
+		baseAmount = amount
+	}
+	baseTax, exists := fields[config.FieldBaseTax].(float64)
+	if !exists {
+		baseTax = tax
+	}
+	baseTotal, exists := fields[config.FieldBaseTotal].(float64)
+	if !exists {
+		baseTotal = total
+	}
+	baseOutstanding, exists := fields[config.FieldBaseOutstanding].(float64)
+	if !exists {
+		baseOutstanding = outstanding
+	}
+	return InvoiceEntry{
+		Number:      number,
+		Customer:    customer,
+		Amount:      amount,
+		Tax:         tax,
+		Date:        date,
+		Status:      status,
+		Due:         due,
+		Total:       total,
+		Paid:        paid,
+		Outstanding: outstanding,
+
+		Currency:        currency,
+		BaseAmount:      baseAmount,
+		BaseTax:         baseTax,
+		BaseTotal:       baseTotal,
+		BaseOutstanding: baseOutstanding,
+	}
+}
+
+//searchAllEntries return all the entries of the search index matching a query
+func searchAllEntries(q query.Query) (entries []InvoiceEntry, err error) {
+	indexPath, exists := config.GetSearchIndexFilePath()
+	if !exists {
+		err = errors.New("search index does not exists, run govoice index to create the index")
+		return
+	}
+	index, err := bleve.Open(indexPath)
+	if err != nil {
+		err = errors.New("error opening the search index")
+		return
+	}
+	defer index.Close()
+
+	count, err := index.DocCount()
+	if err != nil || count == 0 {
+		return
+	}
+	search := bleve.NewSearchRequest(q)
+	search.Fields = entryFields
+	search.SortBy([]string{config.FieldDate, config.FieldNumber})
+	search.Size = int(count)
+	results, err := index.Search(search)
+	if err != nil {
+		err = errors.New("error running the search")
+		return
+	}
+	for _, res := range results.Hits {
+		entries = append(entries, entryFromFields(res.Fields))
+	}
+	return
+}
+
 //initBleveIndex initialize the bleve index and mappings
 func initBleveIndex(dbPath string) (bleve.Index, error) {
 	var index bleve.Index
@@ -266,9 +497,33 @@ func initBleveIndex(dbPath string) (bleve.Index, error) {
 	// numeric mapping for the subtotal
 	afm := bleve.NewNumericFieldMapping()
 	dm.AddFieldMappingsAt(config.FieldAmount, afm)
+	// numeric mapping for the tax
+	tfm := bleve.NewNumericFieldMapping()
+	dm.AddFieldMappingsAt(config.FieldTax, tfm)
+	// numeric mappings for the taxes by rate
+	tdm := bleve.NewDocumentMapping()
+	tdm.AddFieldMappingsAt("Rate", bleve.NewNumericFieldMapping())
+	tdm.AddFieldMappingsAt("Base", bleve.NewNumericFieldMapping())
+	tdm.AddFieldMappingsAt("Amount", bleve.NewNumericFieldMapping())
+	dm.AddSubDocumentMapping(config.FieldTaxes, tdm)
+	// keyword mappings for the credit notes references
+	dm.AddFieldMappingsAt(config.FieldCreditNoteOf, keywordFieldMapping())
+	dm.AddFieldMappingsAt(config.FieldCreditedBy, keywordFieldMapping())
 	// numeric mapping for the date
 	dfm := bleve.NewDateTimeFieldMapping()
 	dm.AddFieldMappingsAt(config.FieldDate, dfm)
+	// mappings for the payment status
+	dm.AddFieldMappingsAt(config.FieldStatus, keywordFieldMapping())
+	dm.AddFieldMappingsAt(config.FieldDue, bleve.NewDateTimeFieldMapping())
+	dm.AddFieldMappingsAt(config.FieldTotal, bleve.NewNumericFieldMapping())
+	dm.AddFieldMappingsAt(config.FieldPaid, bleve.NewNumericFieldMapping())
+	dm.AddFieldMappingsAt(config.FieldOutstanding, bleve.NewNumericFieldMapping())
+	// mappings for the currency and the amounts in the base currency
+	dm.AddFieldMappingsAt(config.FieldCurrency, keywordFieldMapping())
+	dm.AddFieldMappingsAt(config.FieldBaseAmount, bleve.NewNumericFieldMapping())
+	dm.AddFieldMappingsAt(config.FieldBaseTax, bleve.NewNumericFieldMapping())
+	dm.AddFieldMappingsAt(config.FieldBaseTotal, bleve.NewNumericFieldMapping())
+	dm.AddFieldMappingsAt(config.FieldBaseOutstanding, bleve.NewNumericFieldMapping())
 	// add document mapping
 	mapping.AddDocumentMapping("invoice", dm)
 
@@ -281,8 +536,88 @@ func initBleveIndex(dbPath string) (bleve.Index, error) {
 	return index, err
 }
 
+// keywordFieldMapping returns a text mapping indexing the whole value as a single term
+func keywordFieldMapping() *mapping.FieldMapping {
+	fm := bleve.NewTextFieldMapping()
+	fm.Analyzer = keyword.Name
+	return fm
+}
+
+//statusQuery build the query matching a payment status, the status in the index is never overdue:
+// the overdue invoices are the open or partially paid ones with the due date passed
+func statusQuery(status string) (q query.Query, err error) {
+	today := startOfDay(time.Now())
+	term := func(s string) query.Query {
+		tq := bleve.NewTermQuery(s)
+		tq.SetField(config.FieldStatus)
+		return tq
+	}
+	switch status {
+	case config.StatusPaid, config.StatusCredited:
+		q = term(status)
+	case config.StatusOpen, config.StatusPartiallyPaid:
+		// not due yet
+		due := bleve.NewDateRangeQuery(today, time.Time{})
+		due.SetField(config.FieldDue)
+		q = bleve.NewConjunctionQuery(term(status), due)
+	case config.StatusOverdue:
+		due := bleve.NewDateRangeQuery(time.Time{}, today)
+		due.SetField(config.FieldDue)
+		q = bleve.NewConjunctionQuery(bleve.NewDisjunctionQuery(term(config.StatusOpen), term(config.StatusPartiallyPaid)), due)
+	default:
+		err = fmt.Errorf("unknown status '%s', use one of %s", status, strings.Join(PaymentStatuses, ", "))
+	}
+	return
+}
+
 //addToSearchIndex add an invoice to the existing search index
-func addToSearchIndex(i *Invoice) error {
+func addToSearchIndex(i *Invoice, password string) error {
+	ie, err := ledgerEntry(i, password)
+	if err != nil {
+		return err
+	}
+	return updateSearchIndex(ie)
+}
+
+//ledgerEntry create the index entry of an invoice with the payments and the credit note
+//recorded in the ledger, so an invoice rendered again keeps its payment status
+func ledgerEntry(i *Invoice, password string) (ie InvoiceEntry, err error) {
+	if ie, err = invoiceEntry(i); err != nil {
+		return
+	}
+	ledger, err := ReadPaymentLedger(password)
+	if err != nil {
+		return
+	}
+	ie.CreditedBy = ledger.CreditedBy(ie.Number)
+	ie.setPaid(ledger.Paid(ie.Number))
+	return
+}
+
+//invoiceEntry create the index entry of an invoice, parsing the invoice date
+func invoiceEntry(i *Invoice) (ie InvoiceEntry, err error) {
+	// parse the date format
+	format := i.Settings.DateInputFormat
+	if format == "" {
+		format = config.Govoice.DateInputFormat
+	}
+	df := dateFormatToLayout(format)
+	// parse the time
+	date, err := time.Parse(df, i.Invoice.Date)
+	if err != nil {
+		err = fmt.Errorf("date %s doesen't match the format %s", i.Invoice.Date, df)
+		return
+	}
+	rates, err := ReadExchangeRates()
+	if err != nil {
+		return
+	}
+	// create the index entry
+	return newInvoiceEntry(i, date, &rates)
+}
+
+//updateSearchIndex add or replace entries in the existing search index
+func updateSearchIndex(entries ...InvoiceEntry) error {
 	// index
 	indexPath, exists := config.GetSearchIndexFilePath()
 	if !exists {
@@ -295,28 +630,13 @@ func addToSearchIndex(i *Invoice) error {
 		return errors.New("cannot open the search index")
 	}
 	defer index.Close()
-	// parse the date format
-	df := dateFormatToLayout(i.Settings.DateInputFormat)
-	// parse the time
-	date, err := time.Parse(df, i.Invoice.Date)
-	if err != nil {
-		return fmt.Errorf("date %s doesen't match the format %s", i.Invoice.Date, df)
-	}
-	// create the index entry
-	amount, _ := i.GetTotals()
-	ie := InvoiceEntry{
-		Number:   i.Invoice.Number,
-		Customer: i.To.Name,
-		Amount:   amount,
-		Date:     date,
-	}
-	// insert the entry in the index
-	if err := index.Index(i.Invoice.Number, ie); err != nil {
-		return errors.New(fmt.Sprint("error inserting", i.Invoice.Number, "to the search index"))
+	for _, ie := range entries {
+		// insert the entry in the index
+		if err := index.Index(ie.Number, ie); err != nil {
+			return errors.New(fmt.Sprint("error inserting", ie.Number, "to the search index"))
+		}
 	}
-
 	return nil
-
 }
 
 // -------- Utilities --------
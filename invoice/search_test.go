@@ -99,9 +99,9 @@ func invoices() []Invoice {
 			To:             to,
 			PaymentDetails: BankCoordinates{"Mathis Hecht", "B Bank", "DE 1111 1111 1111 1111 11", "XXXXXXXX"},
 			Invoice:        invd,
-			Settings:       InvoiceSettings{45, "", 19, "€", "en", "%y-%m-%d", false},
+			Settings:       InvoiceSettings{ItemsPrice: 45, VatRate: 19, CurrencySymbol: "€", Language: "en", DateInputFormat: "%y-%m-%d"},
 			Dailytime:      Daily{Enabled: false},
-			Items:          &[]Item{Item{"web dev", float64(1 * countdown), 0, ""}, Item{"training", float64(2 * countdown), 5, ""}},
+			Items:          &[]Item{Item{Description: "web dev", Quantity: float64(1 * countdown)}, Item{Description: "training", Quantity: float64(2 * countdown), Price: 5}},
 			Notes:          []string{"first note", "second note"},
 		}
 		invoices = append(invoices, i)
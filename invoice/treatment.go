@@ -0,0 +1,91 @@
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+// Errors
+var (
+	ErrVatNumberRequired       = errors.New("the tax treatment requires the vat number of the sender and of the customer")
+	ErrExemptionReasonRequired = errors.New("the exempt tax treatment requires the exemption reason")
+)
+
+// TaxTreatments are the tax treatments of an invoice
+var TaxTreatments = []string{
+	config.TaxStandard,
+	config.TaxReverseCharge,
+	config.TaxIntraCommunity,
+	config.TaxExport,
+	config.TaxExempt,
+}
+
+// defaultTreatmentNotes are the notes required by the tax treatments, used when
+// the template has no tax_treatment_notes; the exemption reason follows the exempt note
+var defaultTreatmentNotes = map[string]string{
+	config.TaxReverseCharge:  "Reverse charge: VAT to be accounted for by the recipient (Art. 196 Directive 2006/112/EC)",
+	config.TaxIntraCommunity: "VAT exempt intra-Community supply of goods (Art. 138 Directive 2006/112/EC)",
+	config.TaxExport:         "VAT exempt export of goods outside the EU (Art. 146 Directive 2006/112/EC)",
+	config.TaxExempt:         "VAT exempt",
+}
+
+// taxTreatment returns the tax treatment of the settings, standard when missing
+func (s *InvoiceSettings) taxTreatment() string {
+	if t := strings.TrimSpace(s.TaxTreatment); t != "" {
+		return t
+	}
+	return config.TaxStandard
+}
+
+// zeroRated tells if no vat is charged on the items
+func (s *InvoiceSettings) zeroRated() bool {
+	return s.taxTreatment() != config.TaxStandard
+}
+
+// ValidateTaxTreatment checks that the invoice has the data required by its tax treatment:
+// the vat numbers of both parties for reverse charge and intra community supplies
+// (the customer in another EU country for the latter), the reason for exempt invoices
+func (i *Invoice) ValidateTaxTreatment() error {
+	switch t := i.Settings.taxTreatment(); t {
+	case config.TaxStandard, config.TaxExport:
+		return nil
+	case config.TaxReverseCharge, config.TaxIntraCommunity:
+		if strings.TrimSpace(i.From.VatNumber) == "" || strings.TrimSpace(i.To.VatNumber) == "" {
+			return ErrVatNumberRequired
+		}
+		if t == config.TaxIntraCommunity {
+			c := vatCountry(i.To.VatNumber)
+			if c == "" || c == euCountry(i.From.VatNumber, i.From.Country) {
+				return fmt.Errorf("the customer vat number %s is not of another EU country", i.To.VatNumber)
+			}
+		}
+		return nil
+	case config.TaxExempt:
+		if strings.TrimSpace(i.Settings.ExemptionReason) == "" {
+			return ErrExemptionReasonRequired
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown tax treatment '%s', use one of %s", t, strings.Join(TaxTreatments, ", "))
+	}
+}
+
+// treatmentNote returns the note required by the tax treatment of the invoice,
+// from the template or the default one, empty for the standard treatment
+func treatmentNote(i *Invoice, tpl *InvoiceTemplate) string {
+	t := i.Settings.taxTreatment()
+	if t == config.TaxStandard {
+		return ""
+	}
+	note, exists := tpl.Page.TaxTreatmentNotes[t]
+	if !exists {
+		note = defaultTreatmentNotes[t]
+	}
+	if reason := strings.TrimSpace(i.Settings.ExemptionReason); t == config.TaxExempt && reason != "" {
+		note = fmt.Sprint(note, ": ", reason)
+	}
+	return note
+}
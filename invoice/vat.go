@@ -0,0 +1,261 @@
+package invoice
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/almost_cc/govoice/config"
+)
+
+// VatRow is the net amount and the tax of a tax rate for a category of customers
+type VatRow struct {
+	Category string  `json:"category"`
+	Rate     float64 `json:"rate"`
+	Invoices int     `json:"invoices"`
+	Net      float64 `json:"net"`
+	Tax      float64 `json:"tax"`
+}
+
+// VatReport is the vat return of a filing period: the net amount and the tax collected
+// for every tax rate, split between domestic, intra EU (reverse charge) and export customers
+type VatReport struct {
+	Period string    `json:"period"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Currency is the base currency of the amounts
+	Currency string   `json:"currency"`
+	Rows     []VatRow `json:"rates"`
+	// Categories are the totals of every category of customers
+	Categories []VatRow `json:"categories"`
+	Total      VatRow   `json:"total"`
+}
+
+// VatCategories are the categories of customers of the vat report, in report order
+var VatCategories = []string{config.VatDomestic, config.VatIntraEU, config.VatExport}
+
+// euVatPrefixes are the country prefixes of the EU vat numbers and their iso code
+var euVatPrefixes = map[string]string{
+	"AT": "AT", "BE": "BE", "BG": "BG", "CY": "CY", "CZ": "CZ", "DE": "DE", "DK": "DK",
+	"EE": "EE", "EL": "GR", "ES": "ES", "FI": "FI", "FR": "FR", "HR": "HR", "HU": "HU",
+	"IE": "IE", "IT": "IT", "LT": "LT", "LU": "LU", "LV": "LV", "MT": "MT", "NL": "NL",
+	"PL": "PL", "PT": "PT", "RO": "RO", "SE": "SE", "SI": "SI", "SK": "SK", "XI": "XI",
+}
+
+// euCountryNames are the english and local names of the EU countries
+var euCountryNames = map[string]string{
+	"austria": "AT", "österreich": "AT", "belgium": "BE", "belgië": "BE", "belgique": "BE",
+	"bulgaria": "BG", "българия": "BG", "cyprus": "CY", "κύπρος": "CY", "czech republic": "CZ",
+	"czechia": "CZ", "česko": "CZ", "germany": "DE", "deutschland": "DE", "denmark": "DK",
+	"danmark": "DK", "estonia": "EE", "eesti": "EE", "greece": "GR", "ελλάδα": "GR",
+	"spain": "ES", "españa": "ES", "finland": "FI", "suomi": "FI", "france": "FR",
+	"croatia": "HR", "hrvatska": "HR", "hungary": "HU", "magyarország": "HU", "ireland": "IE",
+	"éire": "IE", "italy": "IT", "italia": "IT", "lithuania": "LT", "lietuva": "LT",
+	"luxembourg": "LU", "latvia": "LV", "latvija": "LV", "malta": "MT", "netherlands": "NL",
+	"the netherlands": "NL", "nederland": "NL", "poland": "PL", "polska": "PL", "portugal": "PT",
+	"romania": "RO", "românia": "RO", "sweden": "SE", "sverige": "SE", "slovenia": "SI",
+	"slovenija": "SI", "slovakia": "SK", "slovensko": "SK",
+}
+
+// vatPeriod matches the filing periods: 2026, 2026-Q3 or 2026-07
+var vatPeriod = regexp.MustCompile(`^(\d{4})(?:-Q([1-4])|-(\d{2}))?$`)
+
+// ParseVatPeriod returns the first and the last day of a filing period,
+// a year (2026), a quarter (2026-Q3) or a month (2026-07)
+func ParseVatPeriod(period string) (from, to time.Time, err error) {
+	m := vatPeriod.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(period)))
+	if m == nil {
+		err = fmt.Errorf("invalid period '%s', use a year (2026), a quarter (2026-Q3) or a month (2026-07)", period)
+		return
+	}
+	year, _ := strconv.Atoi(m[1])
+	from, months := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC), 12
+	switch {
+	case m[2] != "":
+		q, _ := strconv.Atoi(m[2])
+		from, months = from.AddDate(0, (q-1)*3, 0), 3
+	case m[3] != "":
+		month, _ := strconv.Atoi(m[3])
+		if month < 1 || month > 12 {
+			err = fmt.Errorf("invalid month in period '%s'", period)
+			return
+		}
+		from, months = from.AddDate(0, month-1, 0), 1
+	}
+	to = from.AddDate(0, months, -1)
+	return
+}
+
+// euCountry returns the iso code of the EU country of a vat number or a country
+// (iso code or name), empty if the country is not in the EU or it is unknown
+func euCountry(vatNumber, country string) string {
+	if c := vatCountry(vatNumber); c != "" {
+		return c
+	}
+	country = strings.ToLower(strings.TrimSpace(country))
+	if c, exists := euVatPrefixes[strings.ToUpper(country)]; exists {
+		return c
+	}
+	return euCountryNames[country]
+}
+
+// vatCountry returns the iso code of the EU country of a vat number, empty if it has no EU prefix
+func vatCountry(vatNumber string) string {
+	v := strings.ToUpper(strings.Replace(strings.TrimSpace(vatNumber), " ", "", -1))
+	if len(v) < 3 {
+		return ""
+	}
+	return euVatPrefixes[v[:2]]
+}
+
+// vatCategory returns the category of the customer of an invoice for the vat report:
+// domestic for customers in the same country, intra EU for customers with an EU vat number
+// of another country (reverse charge), export for customers outside the EU.
+// The EU customers without a vat number are domestic
+func vatCategory(from, to *Recipient) string {
+	home := euCountry(from.VatNumber, from.Country)
+	if c := vatCountry(to.VatNumber); c != "" {
+		if c == home {
+			return config.VatDomestic
+		}
+		return config.VatIntraEU
+	}
+	country := strings.TrimSpace(to.Country)
+	switch {
+	case country == "" || strings.EqualFold(country, strings.TrimSpace(from.Country)):
+		return config.VatDomestic
+	case home != "" && euCountry("", country) != "":
+		// consumers in the EU pay the domestic vat
+		return config.VatDomestic
+	}
+	return config.VatExport
+}
+
+// invoiceVatCategory returns the category of an invoice for the vat report, from the tax
+// treatment of the invoice or, for the standard treatment, from the customer
+func invoiceVatCategory(i *Invoice) string {
+	switch i.Settings.taxTreatment() {
+	case config.TaxReverseCharge, config.TaxIntraCommunity:
+		return config.VatIntraEU
+	case config.TaxExport:
+		return config.VatExport
+	}
+	return vatCategory(&i.From, &i.To)
+}
+
+// vatTotals sums the bases and the taxes of a tax rate
+type vatTotals struct {
+	invoices int
+	net, tax Money
+	// last is the number of the last invoice added, to count every invoice once
+	last string
+}
+
+func (v *vatTotals) add(number string, net, tax Money) {
+	if v.last != number {
+		v.invoices++
+		v.last = number
+	}
+	v.net = v.net.Add(net)
+	v.tax = v.tax.Add(tax)
+}
+
+func (v *vatTotals) row(category string, rate float64) VatRow {
+	return VatRow{Category: category, Rate: rate, Invoices: v.invoices, Net: v.net.Float64(), Tax: v.tax.Float64()}
+}
+
+// GetVatReport decrypts the descriptors of the workspace and builds the vat report of the
+// invoices and credit notes dated in a filing period (ex. 2026-Q3)
+func GetVatReport(period, password string) (report VatReport, err error) {
+	from, to, err := ParseVatPeriod(period)
+	if err != nil {
+		return
+	}
+	names, err := encryptedDescriptors()
+	if err != nil {
+		return
+	}
+	rates, err := ReadExchangeRates()
+	if err != nil {
+		return
+	}
+	var invoices []Invoice
+	for _, n := range names {
+		var i Invoice
+		if i, err = readInvoiceDescriptorEncrypted(path.Join(config.Govoice.Workspace, n), password); err != nil {
+			err = fmt.Errorf("cannot read %s: %v", n, err)
+			return
+		}
+		var d time.Time
+		if d, err = parseInvoiceDate(&i); err != nil {
+			err = fmt.Errorf("invalid date of %s: %v", n, err)
+			return
+		}
+		if !d.Before(from) && !d.After(to) {
+			invoices = append(invoices, i)
+		}
+	}
+	if report, err = newVatReport(invoices, from, to, &rates); err != nil {
+		return
+	}
+	report.Period = strings.ToUpper(strings.TrimSpace(period))
+	return
+}
+
+// newVatReport sums the taxes of the invoices by category of customer and tax rate,
+// converted to the base currency at the date of every invoice
+func newVatReport(invoices []Invoice, from, to time.Time, exchangeRates *ExchangeRates) (report VatReport, err error) {
+	report = VatReport{From: from, To: to, Currency: BaseCurrency()}
+	type rateKey struct {
+		category string
+		rate     float64
+	}
+	rates := make(map[rateKey]*vatTotals)
+	categories := make(map[string]*vatTotals)
+	var total vatTotals
+	for n := range invoices {
+		i := &invoices[n]
+		c, cerr := exchangeRates.invoiceConversion(i)
+		if cerr != nil {
+			err = fmt.Errorf("invoice %s: %v", i.Invoice.Number, cerr)
+			return
+		}
+		category := invoiceVatCategory(i)
+		for _, t := range i.GetTaxes() {
+			base, amount := c.convert(t.Base), c.convert(t.Amount)
+			k := rateKey{category, t.Rate}
+			if _, exists := rates[k]; !exists {
+				rates[k] = &vatTotals{}
+			}
+			if _, exists := categories[category]; !exists {
+				categories[category] = &vatTotals{}
+			}
+			rates[k].add(i.Invoice.Number, base, amount)
+			categories[category].add(i.Invoice.Number, base, amount)
+			total.add(i.Invoice.Number, base, amount)
+		}
+	}
+
+	order := make(map[string]int)
+	for n, c := range VatCategories {
+		order[c] = n
+		if v, exists := categories[c]; exists {
+			report.Categories = append(report.Categories, v.row(c, 0))
+		}
+	}
+	for k, v := range rates {
+		report.Rows = append(report.Rows, v.row(k.category, k.rate))
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		if report.Rows[i].Category != report.Rows[j].Category {
+			return order[report.Rows[i].Category] < order[report.Rows[j].Category]
+		}
+		return report.Rows[i].Rate > report.Rows[j].Rate
+	})
+	report.Total = total.row("", 0)
+	return
+}